@@ -0,0 +1,404 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/LyridInc/cluster-api-go-sdk/model"
+	"github.com/LyridInc/cluster-api-go-sdk/option"
+	"github.com/pmezard/go-difflib/difflib"
+	"gomodules.xyz/jsonpatch/v2"
+	"gopkg.in/yaml.v2"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+)
+
+// ServerSideApplyYaml applies every object of the manifest with server-side apply,
+// in the same order as ApplyYaml. Field ownership conflicts are reported in the
+// returned results instead of aborting the whole manifest.
+func (c *ClusterApiClient) ServerSideApplyYaml(yamlString string, opt option.ServerSideApplyOptions) ([]model.ApplyResult, error) {
+	return c.ServerSideApplyYamlWithContext(context.Background(), yamlString, opt)
+}
+
+func (c *ClusterApiClient) ServerSideApplyYamlWithContext(ctx context.Context, yamlString string, opt option.ServerSideApplyOptions) ([]model.ApplyResult, error) {
+	defer func() { c.LabelSelector = nil }()
+
+	results := []model.ApplyResult{}
+	rawObjs, err := decodeYamlDocuments(yamlString)
+	if err != nil {
+		return results, err
+	}
+
+	err = c.applyInOrder(ctx, rawObjs, "server-side-apply", func(dri dynamic.ResourceInterface, unstructuredObj *unstructured.Unstructured) error {
+		result, err := serverSideApplyObject(ctx, dri, unstructuredObj, opt)
+		if err != nil {
+			return err
+		}
+		results = append(results, *result)
+		return nil
+	})
+
+	return results, err
+}
+
+func serverSideApplyObject(ctx context.Context, dri dynamic.ResourceInterface, obj *unstructured.Unstructured, opt option.ServerSideApplyOptions) (*model.ApplyResult, error) {
+	result := &model.ApplyResult{
+		ApiVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Name:       obj.GetName(),
+		Namespace:  obj.GetNamespace(),
+	}
+
+	data, err := serverSideApplyPatch(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	live, err := getLiveObject(ctx, dri, obj.GetName())
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := dri.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, serverSideApplyPatchOptions(opt, false))
+	if err != nil {
+		if k8serrors.IsConflict(err) {
+			result.Status = model.ApplyStatusConflict
+			result.Message = err.Error()
+			return result, nil
+		}
+		return nil, err
+	}
+
+	switch {
+	case live == nil:
+		result.Status = model.ApplyStatusCreated
+	case live.GetResourceVersion() == applied.GetResourceVersion():
+		result.Status = model.ApplyStatusUnchanged
+	default:
+		result.Status = model.ApplyStatusConfigured
+	}
+
+	return result, nil
+}
+
+// DryRunApplyYaml server-side applies the manifest with DryRun=All and returns
+// the difference between the live objects and the objects the server would persist.
+func (c *ClusterApiClient) DryRunApplyYaml(yamlString string, opt option.ServerSideApplyOptions) ([]model.ObjectDiff, error) {
+	return c.DryRunApplyYamlWithContext(context.Background(), yamlString, opt)
+}
+
+func (c *ClusterApiClient) DryRunApplyYamlWithContext(ctx context.Context, yamlString string, opt option.ServerSideApplyOptions) ([]model.ObjectDiff, error) {
+	defer func() { c.LabelSelector = nil }()
+
+	diffs := []model.ObjectDiff{}
+	rawObjs, err := decodeYamlDocuments(yamlString)
+	if err != nil {
+		return diffs, err
+	}
+
+	for _, rawObj := range rawObjs {
+		dri, unstructuredObj, err := c.createDynamicResourceInterface(ctx, rawObj, "dry-run")
+		if err != nil {
+			if !strings.Contains(error.Error(err), "no matches ") {
+				return diffs, err
+			}
+			// the kind may be registered by a CRD of the same manifest
+			obj := &unstructured.Unstructured{}
+			if err := json.Unmarshal(rawObj.Raw, &obj.Object); err != nil {
+				return diffs, err
+			}
+			diff, err := newObjectDiff(obj, nil, obj)
+			if err != nil {
+				return diffs, err
+			}
+			diff.Message = "resource type is not registered in the cluster"
+			diffs = append(diffs, *diff)
+			continue
+		}
+		if dri == nil {
+			continue
+		}
+
+		live, err := getLiveObject(ctx, *dri, unstructuredObj.GetName())
+		if err != nil {
+			return diffs, err
+		}
+
+		data, err := serverSideApplyPatch(unstructuredObj)
+		if err != nil {
+			return diffs, err
+		}
+
+		desired, err := (*dri).Patch(ctx, unstructuredObj.GetName(), types.ApplyPatchType, data, serverSideApplyPatchOptions(opt, true))
+		if err != nil {
+			if k8serrors.IsConflict(err) {
+				diff, diffErr := newObjectDiff(unstructuredObj, live, live)
+				if diffErr != nil {
+					return diffs, diffErr
+				}
+				diff.Action = model.DiffActionConflict
+				diff.Message = err.Error()
+				diffs = append(diffs, *diff)
+				continue
+			}
+			// the namespace of a new object may be created by an earlier document of the same manifest
+			if !k8serrors.IsNotFound(err) || live != nil {
+				return diffs, err
+			}
+			desired = unstructuredObj
+		}
+
+		diff, err := newObjectDiff(unstructuredObj, live, desired)
+		if err != nil {
+			return diffs, err
+		}
+		diffs = append(diffs, *diff)
+	}
+
+	return diffs, nil
+}
+
+// DryRunDeleteYaml deletes the manifest objects with DryRun=All and returns
+// the live state of every object that would be removed.
+func (c *ClusterApiClient) DryRunDeleteYaml(yamlString string) ([]model.ObjectDiff, error) {
+	return c.DryRunDeleteYamlWithContext(context.Background(), yamlString)
+}
+
+func (c *ClusterApiClient) DryRunDeleteYamlWithContext(ctx context.Context, yamlString string) ([]model.ObjectDiff, error) {
+	defer func() { c.LabelSelector = nil }()
+
+	diffs := []model.ObjectDiff{}
+	rawObjs, err := decodeYamlDocuments(yamlString)
+	if err != nil {
+		return diffs, err
+	}
+
+	for _, rawObj := range rawObjs {
+		dri, unstructuredObj, err := c.createDynamicResourceInterface(ctx, rawObj, "dry-run")
+		if err != nil {
+			if strings.Contains(error.Error(err), "no matches ") {
+				continue
+			}
+			return diffs, err
+		}
+		if dri == nil {
+			continue
+		}
+
+		live, err := getLiveObject(ctx, *dri, unstructuredObj.GetName())
+		if err != nil {
+			return diffs, err
+		}
+
+		if live == nil {
+			diffs = append(diffs, model.ObjectDiff{
+				ApiVersion: unstructuredObj.GetAPIVersion(),
+				Kind:       unstructuredObj.GetKind(),
+				Name:       unstructuredObj.GetName(),
+				Namespace:  unstructuredObj.GetNamespace(),
+				Action:     model.DiffActionNone,
+				Message:    "object not found",
+				JsonPatch:  []model.JsonPatchOperation{},
+			})
+			continue
+		}
+
+		if err := (*dri).Delete(ctx, unstructuredObj.GetName(), metav1.DeleteOptions{DryRun: []string{metav1.DryRunAll}}); err != nil && !k8serrors.IsNotFound(err) {
+			return diffs, err
+		}
+
+		diff, err := newObjectDiff(unstructuredObj, live, nil)
+		if err != nil {
+			return diffs, err
+		}
+		diffs = append(diffs, *diff)
+	}
+
+	return diffs, nil
+}
+
+func serverSideApplyPatch(obj *unstructured.Unstructured) ([]byte, error) {
+	obj.SetManagedFields(nil)
+	obj.SetResourceVersion("")
+	return json.Marshal(obj.Object)
+}
+
+func serverSideApplyPatchOptions(opt option.ServerSideApplyOptions, dryRun bool) metav1.PatchOptions {
+	fieldManager := opt.FieldManager
+	if fieldManager == "" {
+		fieldManager = option.DEFAULT_FIELD_MANAGER
+	}
+
+	force := opt.ForceConflicts
+	patchOptions := metav1.PatchOptions{
+		FieldManager: fieldManager,
+		Force:        &force,
+	}
+	if dryRun {
+		patchOptions.DryRun = []string{metav1.DryRunAll}
+	}
+
+	return patchOptions
+}
+
+// getLiveObject returns nil without an error when the object doesn't exist.
+func getLiveObject(ctx context.Context, dri dynamic.ResourceInterface, name string) (*unstructured.Unstructured, error) {
+	live, err := dri.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return live, nil
+}
+
+func newObjectDiff(obj, live, desired *unstructured.Unstructured) (*model.ObjectDiff, error) {
+	diff := &model.ObjectDiff{
+		ApiVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Name:       obj.GetName(),
+		Namespace:  obj.GetNamespace(),
+		Live:       comparableObject(live),
+		Desired:    comparableObject(desired),
+		JsonPatch:  []model.JsonPatchOperation{},
+	}
+
+	liveYaml, err := marshalComparableObject(diff.Live)
+	if err != nil {
+		return nil, err
+	}
+	desiredYaml, err := marshalComparableObject(diff.Desired)
+	if err != nil {
+		return nil, err
+	}
+
+	diff.Diff, err = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(liveYaml),
+		B:        difflib.SplitLines(desiredYaml),
+		FromFile: "live/" + obj.GetKind() + "/" + obj.GetName(),
+		ToFile:   "desired/" + obj.GetKind() + "/" + obj.GetName(),
+		Context:  3,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	liveJson, err := json.Marshal(diff.Live)
+	if err != nil {
+		return nil, err
+	}
+	desiredJson, err := json.Marshal(diff.Desired)
+	if err != nil {
+		return nil, err
+	}
+	if diff.Live == nil {
+		liveJson = []byte("{}")
+	}
+	if diff.Desired == nil {
+		desiredJson = []byte("{}")
+	}
+
+	operations, err := jsonpatch.CreatePatch(liveJson, desiredJson)
+	if err != nil {
+		return nil, err
+	}
+	for _, operation := range operations {
+		diff.JsonPatch = append(diff.JsonPatch, model.JsonPatchOperation{
+			Op:    operation.Operation,
+			Path:  operation.Path,
+			Value: operation.Value,
+		})
+	}
+
+	switch {
+	case live == nil:
+		diff.Action = model.DiffActionCreate
+	case desired == nil:
+		diff.Action = model.DiffActionDelete
+	case len(diff.JsonPatch) == 0:
+		diff.Action = model.DiffActionNone
+	default:
+		diff.Action = model.DiffActionUpdate
+	}
+
+	return diff, nil
+}
+
+// comparableObject drops the fields the server rewrites on every write so
+// that they don't show up in diffs.
+func comparableObject(obj *unstructured.Unstructured) map[string]interface{} {
+	if obj == nil {
+		return nil
+	}
+
+	obj = obj.DeepCopy()
+	obj.SetManagedFields(nil)
+	obj.SetResourceVersion("")
+	obj.SetGeneration(0)
+	unstructured.RemoveNestedField(obj.Object, "metadata", "creationTimestamp")
+
+	return obj.Object
+}
+
+func marshalComparableObject(obj map[string]interface{}) (string, error) {
+	if obj == nil {
+		return "", nil
+	}
+
+	b, err := yaml.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// decodeYamlDocuments splits a multi-document manifest into raw objects,
+// flattening List kinds into their items.
+func decodeYamlDocuments(yamlString string) ([]runtime.RawExtension, error) {
+	var err error
+	rawObjs := []runtime.RawExtension{}
+	decoder := yamlutil.NewYAMLOrJSONDecoder(bytes.NewReader([]byte(yamlString)), 100)
+	for {
+		var rawObj runtime.RawExtension
+		if err = decoder.Decode(&rawObj); err != nil {
+			break
+		}
+		if len(rawObj.Raw) == 0 || string(rawObj.Raw) == "null" {
+			continue
+		}
+
+		obj := &unstructured.Unstructured{}
+		if err := json.Unmarshal(rawObj.Raw, &obj.Object); err != nil {
+			return nil, err
+		}
+		if !obj.IsList() {
+			rawObjs = append(rawObjs, rawObj)
+			continue
+		}
+
+		items, _, _ := unstructured.NestedSlice(obj.Object, "items")
+		for _, item := range items {
+			b, err := json.Marshal(item)
+			if err != nil {
+				return nil, err
+			}
+			rawObjs = append(rawObjs, runtime.RawExtension{Raw: b})
+		}
+	}
+	if err != io.EOF {
+		return nil, err
+	}
+
+	return rawObjs, nil
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	controlplanev1 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1beta1"
+)
+
+var (
+	clusterResource             = clusterv1.GroupVersion.WithResource("clusters")
+	machineResource             = clusterv1.GroupVersion.WithResource("machines")
+	machineDeploymentResource   = clusterv1.GroupVersion.WithResource("machinedeployments")
+	machineSetResource          = clusterv1.GroupVersion.WithResource("machinesets")
+	kubeadmControlPlaneResource = controlplanev1.GroupVersion.WithResource("kubeadmcontrolplanes")
+	machineHealthCheckResource  = clusterv1.GroupVersion.WithResource("machinehealthchecks")
+	clusterClassResource        = clusterv1.GroupVersion.WithResource("clusterclasses")
+)
+
+func (c *ClusterApiClient) GetCluster(ctx context.Context, name, namespace string) (*clusterv1.Cluster, error) {
+	obj := &clusterv1.Cluster{}
+	if err := c.getCapiObject(ctx, clusterResource, namespace, name, obj); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+func (c *ClusterApiClient) ListClusters(ctx context.Context, namespace, labelSelector string) (*clusterv1.ClusterList, error) {
+	list := &clusterv1.ClusterList{}
+	if err := c.listCapiObjects(ctx, clusterResource, namespace, labelSelector, list); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (c *ClusterApiClient) GetMachine(ctx context.Context, name, namespace string) (*clusterv1.Machine, error) {
+	obj := &clusterv1.Machine{}
+	if err := c.getCapiObject(ctx, machineResource, namespace, name, obj); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+func (c *ClusterApiClient) ListMachines(ctx context.Context, namespace, labelSelector string) (*clusterv1.MachineList, error) {
+	list := &clusterv1.MachineList{}
+	if err := c.listCapiObjects(ctx, machineResource, namespace, labelSelector, list); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (c *ClusterApiClient) GetMachineDeployment(ctx context.Context, name, namespace string) (*clusterv1.MachineDeployment, error) {
+	obj := &clusterv1.MachineDeployment{}
+	if err := c.getCapiObject(ctx, machineDeploymentResource, namespace, name, obj); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+func (c *ClusterApiClient) ListMachineDeployments(ctx context.Context, namespace, labelSelector string) (*clusterv1.MachineDeploymentList, error) {
+	list := &clusterv1.MachineDeploymentList{}
+	if err := c.listCapiObjects(ctx, machineDeploymentResource, namespace, labelSelector, list); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (c *ClusterApiClient) GetMachineSet(ctx context.Context, name, namespace string) (*clusterv1.MachineSet, error) {
+	obj := &clusterv1.MachineSet{}
+	if err := c.getCapiObject(ctx, machineSetResource, namespace, name, obj); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+func (c *ClusterApiClient) ListMachineSets(ctx context.Context, namespace, labelSelector string) (*clusterv1.MachineSetList, error) {
+	list := &clusterv1.MachineSetList{}
+	if err := c.listCapiObjects(ctx, machineSetResource, namespace, labelSelector, list); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (c *ClusterApiClient) GetKubeadmControlPlane(ctx context.Context, name, namespace string) (*controlplanev1.KubeadmControlPlane, error) {
+	obj := &controlplanev1.KubeadmControlPlane{}
+	if err := c.getCapiObject(ctx, kubeadmControlPlaneResource, namespace, name, obj); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+func (c *ClusterApiClient) ListKubeadmControlPlanes(ctx context.Context, namespace, labelSelector string) (*controlplanev1.KubeadmControlPlaneList, error) {
+	list := &controlplanev1.KubeadmControlPlaneList{}
+	if err := c.listCapiObjects(ctx, kubeadmControlPlaneResource, namespace, labelSelector, list); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (c *ClusterApiClient) GetMachineHealthCheck(ctx context.Context, name, namespace string) (*clusterv1.MachineHealthCheck, error) {
+	obj := &clusterv1.MachineHealthCheck{}
+	if err := c.getCapiObject(ctx, machineHealthCheckResource, namespace, name, obj); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+func (c *ClusterApiClient) ListMachineHealthChecks(ctx context.Context, namespace, labelSelector string) (*clusterv1.MachineHealthCheckList, error) {
+	list := &clusterv1.MachineHealthCheckList{}
+	if err := c.listCapiObjects(ctx, machineHealthCheckResource, namespace, labelSelector, list); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (c *ClusterApiClient) GetClusterClass(ctx context.Context, name, namespace string) (*clusterv1.ClusterClass, error) {
+	obj := &clusterv1.ClusterClass{}
+	if err := c.getCapiObject(ctx, clusterClassResource, namespace, name, obj); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+func (c *ClusterApiClient) ListClusterClasses(ctx context.Context, namespace, labelSelector string) (*clusterv1.ClusterClassList, error) {
+	list := &clusterv1.ClusterClassList{}
+	if err := c.listCapiObjects(ctx, clusterClassResource, namespace, labelSelector, list); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// ClusterLabelSelector returns the label selector matching the objects owned by a workload cluster.
+func ClusterLabelSelector(clusterName string) string {
+	return clusterv1.ClusterNameLabel + "=" + clusterName
+}
+
+func (c *ClusterApiClient) getCapiObject(ctx context.Context, resource schema.GroupVersionResource, namespace, name string, out interface{}) error {
+	obj, err := c.DynamicInterface.Resource(resource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, out)
+}
+
+func (c *ClusterApiClient) listCapiObjects(ctx context.Context, resource schema.GroupVersionResource, namespace, labelSelector string, out interface{}) error {
+	list, err := c.DynamicInterface.Resource(resource).Namespace(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return err
+	}
+
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(list.UnstructuredContent(), out)
+}
@@ -8,16 +8,17 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"os"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"math/rand"
 
 	"github.com/LyridInc/cluster-api-go-sdk/model"
 	"github.com/LyridInc/cluster-api-go-sdk/option"
+	"github.com/LyridInc/cluster-api-go-sdk/utils"
 	"gopkg.in/yaml.v2"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
@@ -32,11 +33,13 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/clientcmd"
+	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
 	"sigs.k8s.io/cluster-api/cmd/clusterctl/client"
 	"sigs.k8s.io/cluster-api/cmd/clusterctl/client/tree"
 )
@@ -52,87 +55,173 @@ type (
 		KubeconfigFile   string
 		LabelSelector    *metav1.LabelSelector
 		ConfigBytes      []byte
+		// KubeconfigContext selects a context of ConfigBytes, the current context is used when empty.
+		KubeconfigContext string
+
+		workloadDial    DialFunc
+		workloadProxy   ProxyFunc
+		workloadMu      sync.Mutex
+		workloadClients map[string]*workloadClientEntry
+
+		mapperMu        sync.Mutex
+		mapper          *restmapper.DeferredDiscoveryRESTMapper
+		mapperClientset *kubernetes.Clientset
 	}
 )
 
 func NewClusterApiClient(configFile, kubeconfigFile string) (*ClusterApiClient, error) {
-	cl, err := client.New(context.Background(), configFile)
-	if err != nil {
-		log.Fatal("Client config error:", err)
-		return nil, err
+	return NewClusterApiClientWithOptions(
+		WithClusterctlConfigFile(configFile),
+		WithKubeconfigFile(kubeconfigFile),
+	)
+}
+
+func NewClusterApiClientWithOptions(opts ...ClusterApiClientOption) (*ClusterApiClient, error) {
+	o := &clusterApiClientOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var (
+		conf            *rest.Config
+		kubeconfigBytes []byte
+		err             error
+	)
+	switch {
+	case o.restConfig != nil:
+		conf = rest.CopyConfig(o.restConfig)
+	case o.inCluster:
+		conf, err = rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidKubeconfig, err)
+		}
+	case o.kubeconfigBytes != nil:
+		kubeconfigBytes = o.kubeconfigBytes
+		conf, err = restConfigFromKubeconfig(kubeconfigBytes, o.kubeconfigContext)
+		if err != nil {
+			return nil, err
+		}
+	case o.kubeconfigFile != "":
+		kubeconfigBytes, err = readKubeconfigFile(o.kubeconfigFile)
+		if err != nil {
+			return nil, err
+		}
+		conf, err = restConfigFromKubeconfig(kubeconfigBytes, o.kubeconfigContext)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		conf, err = clientcmd.BuildConfigFromFlags("", "")
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidKubeconfig, err)
+		}
+	}
+
+	if o.burst > 0 {
+		conf.Burst = o.burst
+	}
+	if o.qps > 0 {
+		conf.QPS = o.qps
+	}
+	if o.dial != nil {
+		conf.Dial = o.dial
+	}
+	if o.proxy != nil {
+		conf.Proxy = o.proxy
 	}
 
-	conf, err := clientcmd.BuildConfigFromFlags("", kubeconfigFile)
+	clientset, dd, err := newKubernetesClients(conf)
 	if err != nil {
-		log.Fatal("Build config from flags error:", err)
 		return nil, err
 	}
 
-	clientset, err := kubernetes.NewForConfig(conf)
+	c := &ClusterApiClient{
+		Clientset:         clientset,
+		Config:            conf,
+		DynamicInterface:  dd,
+		ConfigFile:        o.configFile,
+		KubeconfigFile:    o.kubeconfigFile,
+		LabelSelector:     nil,
+		ConfigBytes:       kubeconfigBytes,
+		KubeconfigContext: o.kubeconfigContext,
+		workloadDial:      o.workloadDial,
+		workloadProxy:     o.workloadProxy,
+	}
+	c.Client, err = c.newClusterctlClient(context.Background(), nil, nil)
 	if err != nil {
-		log.Fatal("Clientset config error:", err)
 		return nil, err
 	}
 
-	dd, err := dynamic.NewForConfig(conf)
+	return c, nil
+}
+
+// readKubeconfigFile returns the kubeconfig with the paths of certificate and key files made
+// absolute, so that the bytes can be used without the file location.
+func readKubeconfigFile(kubeconfigFile string) ([]byte, error) {
+	kubeconfig, err := clientcmd.LoadFromFile(kubeconfigFile)
 	if err != nil {
-		log.Fatal("Dynamic interface config error:", err)
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKubeconfig, err)
+	}
+	if err := clientcmd.ResolveLocalPaths(kubeconfig); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKubeconfig, err)
+	}
+	kubeconfigBytes, err := clientcmd.Write(*kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKubeconfig, err)
 	}
 
-	kubeconfigBytes, _ := os.ReadFile(kubeconfigFile)
+	return kubeconfigBytes, nil
+}
 
-	return &ClusterApiClient{
-		Client:           cl,
-		Clientset:        clientset,
-		Config:           conf,
-		DynamicInterface: dd,
-		ConfigFile:       configFile,
-		KubeconfigFile:   kubeconfigFile,
-		LabelSelector:    nil,
-		ConfigBytes:      kubeconfigBytes,
-	}, nil
+func restConfigFromKubeconfig(kubeconfigBytes []byte, kubeconfigContext string) (*rest.Config, error) {
+	kubeconfig, err := clientcmd.Load(kubeconfigBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKubeconfig, err)
+	}
+	conf, err := clientcmd.NewDefaultClientConfig(*kubeconfig, &clientcmd.ConfigOverrides{
+		CurrentContext: kubeconfigContext,
+	}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKubeconfig, err)
+	}
+
+	return conf, nil
 }
 
 func (c *ClusterApiClient) SetRateLimit(burst int, qps float32) error {
-	cl, err := client.New(context.Background(), c.ConfigFile)
+	cl, err := c.newClusterctlClient(context.Background(), nil, nil)
 	if err != nil {
-		log.Fatal("Client config error:", err)
 		return err
 	}
 
 	var conf *rest.Config
-	if c.ConfigBytes == nil {
-		conf, err = clientcmd.BuildConfigFromFlags("", c.KubeconfigFile)
+	switch {
+	case c.ConfigBytes != nil:
+		conf, err = restConfigFromKubeconfig(c.ConfigBytes, c.KubeconfigContext)
 		if err != nil {
-			log.Fatal("Build config from flags error:", err)
 			return err
 		}
-	} else {
-		conf, err = clientcmd.RESTConfigFromKubeConfig(c.ConfigBytes)
+	case c.KubeconfigFile == "" && c.Config != nil:
+		conf = rest.CopyConfig(c.Config)
+	default:
+		conf, err = clientcmd.BuildConfigFromFlags("", c.KubeconfigFile)
 		if err != nil {
-			return err
+			return fmt.Errorf("%w: %w", ErrInvalidKubeconfig, err)
 		}
 	}
 
 	conf.Burst = burst
 	conf.QPS = qps
 
-	clientset, err := kubernetes.NewForConfig(conf)
-	if err != nil {
-		log.Fatal("Clientset config error:", err)
-		return err
-	}
-
-	dd, err := dynamic.NewForConfig(conf)
+	clientset, dd, err := newKubernetesClients(conf)
 	if err != nil {
-		log.Fatal("Dynamic interface config error:", err)
 		return err
 	}
 
 	c.DynamicInterface = dd
 	c.Clientset = clientset
 	c.Client = cl
+	c.Config = conf
 
 	return nil
 }
@@ -140,7 +229,7 @@ func (c *ClusterApiClient) SetRateLimit(burst int, qps float32) error {
 func (c *ClusterApiClient) GetConfigValues(configBytes []byte) (map[string]interface{}, error) {
 	conf, err := clientcmd.RESTConfigFromKubeConfig(configBytes)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKubeconfig, err)
 	}
 
 	return map[string]interface{}{
@@ -151,23 +240,19 @@ func (c *ClusterApiClient) GetConfigValues(configBytes []byte) (map[string]inter
 	}, nil
 }
 
+// SetKubernetesClientsetFromConfigBytes switches the client, including clusterctl operations,
+// to the cluster of configBytes.
 func (c *ClusterApiClient) SetKubernetesClientsetFromConfigBytes(configBytes []byte) error {
-	conf, err := clientcmd.RESTConfigFromKubeConfig(configBytes)
+	conf, err := restConfigFromKubeconfig(configBytes, c.KubeconfigContext)
 	if err != nil {
 		return err
 	}
 
-	clientset, err := kubernetes.NewForConfig(conf)
+	clientset, dd, err := newKubernetesClients(conf)
 	if err != nil {
 		return err
 	}
 
-	dd, err := dynamic.NewForConfig(conf)
-	if err != nil {
-		log.Fatal("Dynamic interface config error:", err)
-		return nil
-	}
-
 	c.Clientset = clientset
 	c.DynamicInterface = dd
 	c.ConfigBytes = configBytes
@@ -176,7 +261,7 @@ func (c *ClusterApiClient) SetKubernetesClientsetFromConfigBytes(configBytes []b
 }
 
 func (c *ClusterApiClient) SetRateLimitFromConfigBytes(burst int, qps float32, configBytes []byte) error {
-	conf, err := clientcmd.RESTConfigFromKubeConfig(configBytes)
+	conf, err := restConfigFromKubeconfig(configBytes, c.KubeconfigContext)
 	if err != nil {
 		return err
 	}
@@ -184,15 +269,8 @@ func (c *ClusterApiClient) SetRateLimitFromConfigBytes(burst int, qps float32, c
 	conf.Burst = burst
 	conf.QPS = qps
 
-	clientset, err := kubernetes.NewForConfig(conf)
-	if err != nil {
-		log.Fatal("Clientset config error:", err)
-		return err
-	}
-
-	dd, err := dynamic.NewForConfig(conf)
+	clientset, dd, err := newKubernetesClients(conf)
 	if err != nil {
-		log.Fatal("Dynamic interface config error:", err)
 		return err
 	}
 
@@ -205,30 +283,49 @@ func (c *ClusterApiClient) SetRateLimitFromConfigBytes(burst int, qps float32, c
 }
 
 func (c *ClusterApiClient) SetKubernetesClientset(kubeconfigFile string) error {
-	conf, err := clientcmd.BuildConfigFromFlags("", kubeconfigFile)
+	configBytes, err := readKubeconfigFile(kubeconfigFile)
 	if err != nil {
 		return err
 	}
-
-	clientset, err := kubernetes.NewForConfig(conf)
+	conf, err := restConfigFromKubeconfig(configBytes, c.KubeconfigContext)
 	if err != nil {
 		return err
 	}
 
-	dd, err := dynamic.NewForConfig(conf)
+	clientset, dd, err := newKubernetesClients(conf)
 	if err != nil {
-		log.Fatal("Dynamic interface config error:", err)
-		return nil
+		return err
 	}
 
 	c.Clientset = clientset
 	c.DynamicInterface = dd
+	c.KubeconfigFile = kubeconfigFile
+	c.ConfigBytes = configBytes
+	c.Config = conf
 	return nil
 }
 
+func newKubernetesClients(conf *rest.Config) (*kubernetes.Clientset, dynamic.Interface, error) {
+	clientset, err := kubernetes.NewForConfig(conf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrKubernetesClient, err)
+	}
+
+	dd, err := dynamic.NewForConfig(conf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrKubernetesClient, err)
+	}
+
+	return clientset, dd, nil
+}
+
 func (c *ClusterApiClient) InitInfrastructure(infrastructure string) ([]client.Components, error) {
+	return c.InitInfrastructureWithContext(context.Background(), infrastructure)
+}
+
+func (c *ClusterApiClient) InitInfrastructureWithContext(ctx context.Context, infrastructure string) ([]client.Components, error) {
 	c.InitOptions = client.InitOptions{
-		Kubeconfig:              client.Kubeconfig{Path: c.KubeconfigFile},
+		Kubeconfig:              c.clusterctlKubeconfig(),
 		CoreProvider:            "",
 		InfrastructureProviders: []string{infrastructure},
 		BootstrapProviders:      nil,
@@ -239,20 +336,74 @@ func (c *ClusterApiClient) InitInfrastructure(infrastructure string) ([]client.C
 		WaitProviderTimeout:     time.Duration(5*60) * time.Second,
 	}
 
-	result, err := c.Client.Init(context.Background(), c.InitOptions)
+	result, err := c.Client.Init(ctx, c.InitOptions)
 	if err != nil {
 		return nil, err
 	}
 
-	if ready, err := c.InfrastructureReadiness(infrastructure); !ready || err != nil {
+	if ready, err := c.InfrastructureReadinessWithContext(ctx, infrastructure); !ready || err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
+// InitInfrastructureWithOptions runs clusterctl init with any combination of providers, e.g.
+// a k0smotron or RKE2 bootstrap provider instead of kubeadm.
+func (c *ClusterApiClient) InitInfrastructureWithOptions(ctx context.Context, opt option.InitInfrastructureOptions) ([]client.Components, error) {
+	if opt.WaitProviderTimeout == 0 {
+		opt.WaitProviderTimeout = time.Duration(5*60) * time.Second
+	}
+
+	refs := providerRefs{}
+	if opt.CoreProvider.Name != "" {
+		refs.add(clusterctlv1.CoreProviderType, initProviderRef(opt.CoreProvider))
+	}
+	for providerType, providers := range map[clusterctlv1.ProviderType][]option.InitProvider{
+		clusterctlv1.BootstrapProviderType:        opt.BootstrapProviders,
+		clusterctlv1.ControlPlaneProviderType:     opt.ControlPlaneProviders,
+		clusterctlv1.InfrastructureProviderType:   opt.InfrastructureProviders,
+		clusterctlv1.IPAMProviderType:             opt.IPAMProviders,
+		clusterctlv1.RuntimeExtensionProviderType: opt.RuntimeExtensionProviders,
+		clusterctlv1.AddonProviderType:            opt.AddonProviders,
+	} {
+		for _, provider := range providers {
+			refs.add(providerType, initProviderRef(provider))
+		}
+	}
+
+	c.InitOptions = client.InitOptions{
+		Kubeconfig:                c.clusterctlKubeconfig(),
+		CoreProvider:              refs.core,
+		BootstrapProviders:        refs.bootstrap,
+		ControlPlaneProviders:     refs.controlPlane,
+		InfrastructureProviders:   refs.infrastructure,
+		IPAMProviders:             refs.ipam,
+		RuntimeExtensionProviders: refs.runtimeExtension,
+		AddonProviders:            refs.addon,
+		TargetNamespace:           opt.TargetNamespace,
+		LogUsageInstructions:      true,
+		WaitProviders:             opt.WaitProviders,
+		WaitProviderTimeout:       opt.WaitProviderTimeout,
+		IgnoreValidationErrors:    opt.IgnoreValidationErrors,
+	}
+
+	return c.Client.Init(ctx, c.InitOptions)
+}
+
+func initProviderRef(provider option.InitProvider) string {
+	if provider.Version == "" {
+		return provider.Name
+	}
+	return provider.Name + ":" + provider.Version
+}
+
 func (c *ClusterApiClient) DeleteInfrastructure(infrastructure string) error {
-	return c.Client.Delete(context.Background(), client.DeleteOptions{
-		Kubeconfig:              client.Kubeconfig{Path: c.KubeconfigFile},
+	return c.DeleteInfrastructureWithContext(context.Background(), infrastructure)
+}
+
+func (c *ClusterApiClient) DeleteInfrastructureWithContext(ctx context.Context, infrastructure string) error {
+	return c.Client.Delete(ctx, client.DeleteOptions{
+		Kubeconfig:              c.clusterctlKubeconfig(),
 		IncludeNamespace:        false,
 		IncludeCRDs:             false,
 		CoreProvider:            "",
@@ -264,8 +415,16 @@ func (c *ClusterApiClient) DeleteInfrastructure(infrastructure string) error {
 }
 
 func (c *ClusterApiClient) GenerateWorkloadClusterYaml(opt option.GenerateWorkloadClusterOptions) (string, error) {
+	return c.GenerateWorkloadClusterYamlWithContext(context.Background(), opt)
+}
+
+func (c *ClusterApiClient) GenerateWorkloadClusterYamlWithContext(ctx context.Context, opt option.GenerateWorkloadClusterOptions) (string, error) {
+	return c.getClusterTemplateYaml(ctx, c.workloadClusterTemplateOptions(opt), opt.Variables)
+}
+
+func (c *ClusterApiClient) workloadClusterTemplateOptions(opt option.GenerateWorkloadClusterOptions) client.GetClusterTemplateOptions {
 	templateOptions := client.GetClusterTemplateOptions{
-		Kubeconfig:               client.Kubeconfig{Path: c.KubeconfigFile},
+		Kubeconfig:               c.clusterctlKubeconfig(),
 		ClusterName:              opt.ClusterName,
 		TargetNamespace:          opt.TargetNamespace,
 		KubernetesVersion:        opt.KubernetesVersion,
@@ -287,42 +446,36 @@ func (c *ClusterApiClient) GenerateWorkloadClusterYaml(opt option.GenerateWorklo
 		}
 	}
 
-	template, err := c.Client.GetClusterTemplate(context.Background(), templateOptions)
-	if err != nil {
-		return "", err
-	}
-
-	yaml, err := template.Yaml()
-	if err != nil {
-		return "", err
-	}
-
-	return string(yaml), nil
+	return templateOptions
 }
 
 func (c *ClusterApiClient) GenerateOciWorkloadClusterYaml(opt option.GenerateOciWorkloadClusterOption) (string, error) {
-	os.Setenv("OCI_COMPARTMENT_ID", opt.CompartmentID)
-	os.Setenv("OCI_MANAGED_NODE_IMAGE_ID", opt.ImageID)
-	os.Setenv("OCI_MANAGED_NODE_SHAPE", opt.Shape)
-	os.Setenv("OCI_SSH_KEY", opt.SSHKey)
-	os.Setenv("OCI_REGION", opt.Region)
-	os.Setenv("OCI_WORKLOAD_REGION", opt.WorkloadRegion)
-	os.Setenv("KUBERNETES_VERSION", opt.KubernetesVersion)
-	os.Setenv("NAMESPACE", opt.Namespace)
-	os.Setenv("NODE_MACHINE_COUNT", fmt.Sprintf("%d", opt.MachineCount))
+	return c.GenerateOciWorkloadClusterYamlWithContext(context.Background(), opt)
+}
+
+func (c *ClusterApiClient) GenerateOciWorkloadClusterYamlWithContext(ctx context.Context, opt option.GenerateOciWorkloadClusterOption) (string, error) {
+	variables := map[string]string{
+		"OCI_COMPARTMENT_ID":        opt.CompartmentID,
+		"OCI_MANAGED_NODE_IMAGE_ID": opt.ImageID,
+		"OCI_MANAGED_NODE_SHAPE":    opt.Shape,
+		"OCI_SSH_KEY":               opt.SSHKey,
+		"OCI_REGION":                opt.Region,
+		"OCI_WORKLOAD_REGION":       opt.WorkloadRegion,
+		"KUBERNETES_VERSION":        opt.KubernetesVersion,
+		"NAMESPACE":                 opt.Namespace,
+		"NODE_MACHINE_COUNT":        fmt.Sprintf("%d", opt.MachineCount),
+	}
 
 	if opt.MachineTypeOCPU > 0 {
-		os.Setenv("OCI_MANAGED_NODE_MACHINE_TYPE_OCPUS", fmt.Sprintf("%d", opt.MachineTypeOCPU))
+		variables["OCI_MANAGED_NODE_MACHINE_TYPE_OCPUS"] = fmt.Sprintf("%d", opt.MachineTypeOCPU)
 	}
 	if opt.BootVolumeSize != 0 {
-		os.Setenv("OCI_MANAGED_NODE_BOOT_VOLUME_SIZE", fmt.Sprintf("%d", opt.BootVolumeSize))
+		variables["OCI_MANAGED_NODE_BOOT_VOLUME_SIZE"] = fmt.Sprintf("%d", opt.BootVolumeSize)
 	}
 
 	var controlMachineCount int64 = 1
 	templateOptions := client.GetClusterTemplateOptions{
-		Kubeconfig: client.Kubeconfig{
-			Path: c.KubeconfigFile,
-		},
+		Kubeconfig:               c.clusterctlKubeconfig(),
 		ClusterName:              opt.ClusterName,
 		TargetNamespace:          opt.Namespace,
 		KubernetesVersion:        opt.KubernetesVersion,
@@ -337,41 +490,35 @@ func (c *ClusterApiClient) GenerateOciWorkloadClusterYaml(opt option.GenerateOci
 		}
 	}
 
-	template, err := c.Client.GetClusterTemplate(context.Background(), templateOptions)
-	if err != nil {
-		return "", err
-	}
-
-	yaml, err := template.Yaml()
-	if err != nil {
-		return "", err
-	}
-
-	return string(yaml), nil
+	return c.getClusterTemplateYaml(ctx, templateOptions, variables)
 }
 
 func (c *ClusterApiClient) GenerateCloudStackWorkloadClusterYaml(opt option.GenerateCloudStackWorkloadClusterOption) (string, error) {
-	os.Setenv("CLOUDSTACK_ZONE_NAME", opt.ZoneName)
-	os.Setenv("CLOUDSTACK_NETWORK_NAME", opt.NetworkName)
-	os.Setenv("CLUSTER_ENDPOINT_IP", opt.ClusterEndpointIP)
-	os.Setenv("CLUSTER_ENDPOINT_PORT", opt.ClusterEndpointPort)
-	os.Setenv("CLOUDSTACK_CONTROL_PLANE_MACHINE_OFFERING", opt.ControlPlaneMachineOffering)
-	os.Setenv("CLOUDSTACK_WORKER_MACHINE_OFFERING", opt.WorkerMachineOffering)
-	os.Setenv("CLOUDSTACK_TEMPLATE_NAME", opt.TemplateName)
-	os.Setenv("CLOUDSTACK_SSH_KEY_NAME", opt.SshKeyName)
-	os.Setenv("CLOUDSTACK_AFFINITY_GROUP_ID", opt.AffinityGroupId)
-	os.Setenv("CLOUDSTACK_VPC_NETWORK_NAME_WITH_CUSTOM_OFFERING", opt.NetworkName)
-	os.Setenv("CLOUDSTACK_CUSTOM_VPC_NETWORK_OFFERING_NAME", opt.NetworkOffering)
-	os.Setenv("CLOUDSTACK_VPC_CIDR", opt.VpcCidr)
-	os.Setenv("CLOUDSTACK_VPC_NAME_WITH_CUSTOM_OFFERING", opt.VpcName)
-	os.Setenv("CLOUDSTACK_CUSTOM_VPC_OFFERING_NAME", opt.VpcOffering)
-	os.Setenv("CLOUDSTACK_GATEWAY", opt.Gateway)
-	os.Setenv("CLOUDSTACK_NETMASK", opt.Netmask)
+	return c.GenerateCloudStackWorkloadClusterYamlWithContext(context.Background(), opt)
+}
+
+func (c *ClusterApiClient) GenerateCloudStackWorkloadClusterYamlWithContext(ctx context.Context, opt option.GenerateCloudStackWorkloadClusterOption) (string, error) {
+	variables := map[string]string{
+		"CLOUDSTACK_ZONE_NAME":                             opt.ZoneName,
+		"CLOUDSTACK_NETWORK_NAME":                          opt.NetworkName,
+		"CLUSTER_ENDPOINT_IP":                              opt.ClusterEndpointIP,
+		"CLUSTER_ENDPOINT_PORT":                            opt.ClusterEndpointPort,
+		"CLOUDSTACK_CONTROL_PLANE_MACHINE_OFFERING":        opt.ControlPlaneMachineOffering,
+		"CLOUDSTACK_WORKER_MACHINE_OFFERING":               opt.WorkerMachineOffering,
+		"CLOUDSTACK_TEMPLATE_NAME":                         opt.TemplateName,
+		"CLOUDSTACK_SSH_KEY_NAME":                          opt.SshKeyName,
+		"CLOUDSTACK_AFFINITY_GROUP_ID":                     opt.AffinityGroupId,
+		"CLOUDSTACK_VPC_NETWORK_NAME_WITH_CUSTOM_OFFERING": opt.NetworkName,
+		"CLOUDSTACK_CUSTOM_VPC_NETWORK_OFFERING_NAME":      opt.NetworkOffering,
+		"CLOUDSTACK_VPC_CIDR":                              opt.VpcCidr,
+		"CLOUDSTACK_VPC_NAME_WITH_CUSTOM_OFFERING":         opt.VpcName,
+		"CLOUDSTACK_CUSTOM_VPC_OFFERING_NAME":              opt.VpcOffering,
+		"CLOUDSTACK_GATEWAY":                               opt.Gateway,
+		"CLOUDSTACK_NETMASK":                               opt.Netmask,
+	}
 
 	templateOptions := client.GetClusterTemplateOptions{
-		Kubeconfig: client.Kubeconfig{
-			Path: c.KubeconfigFile,
-		},
+		Kubeconfig:               c.clusterctlKubeconfig(),
 		ClusterName:              opt.ClusterName,
 		TargetNamespace:          opt.Namespace,
 		KubernetesVersion:        opt.KubernetesVersion,
@@ -386,31 +533,25 @@ func (c *ClusterApiClient) GenerateCloudStackWorkloadClusterYaml(opt option.Gene
 		}
 	}
 
-	template, err := c.Client.GetClusterTemplate(context.Background(), templateOptions)
-	if err != nil {
-		return "", err
-	}
-
-	yaml, err := template.Yaml()
-	if err != nil {
-		return "", err
-	}
-
-	return string(yaml), nil
+	return c.getClusterTemplateYaml(ctx, templateOptions, variables)
 }
 
 func (c *ClusterApiClient) GenerateAwsWorkloadClusterYaml(opt option.GenerateAwsWorkloadClusterOption) (string, error) {
-	os.Setenv("AWS_REGION", opt.Region)
-	os.Setenv("AWS_SSH_KEY_NAME", opt.SshKeyName)
-	os.Setenv("KUBERNETES_VERSION", opt.KubernetesVersion)
-	os.Setenv("FLAVOR", opt.Flavor)
-	os.Setenv("WORKER_MACHINE_COUNT", fmt.Sprintf("%d", opt.WorkerMachineCount))
+	return c.GenerateAwsWorkloadClusterYamlWithContext(context.Background(), opt)
+}
+
+func (c *ClusterApiClient) GenerateAwsWorkloadClusterYamlWithContext(ctx context.Context, opt option.GenerateAwsWorkloadClusterOption) (string, error) {
+	variables := map[string]string{
+		"AWS_REGION":           opt.Region,
+		"AWS_SSH_KEY_NAME":     opt.SshKeyName,
+		"KUBERNETES_VERSION":   opt.KubernetesVersion,
+		"FLAVOR":               opt.Flavor,
+		"WORKER_MACHINE_COUNT": fmt.Sprintf("%d", opt.WorkerMachineCount),
+	}
 
 	var controlMachineCount int64 = 1
 	templateOptions := client.GetClusterTemplateOptions{
-		Kubeconfig: client.Kubeconfig{
-			Path: c.KubeconfigFile,
-		},
+		Kubeconfig:               c.clusterctlKubeconfig(),
 		ClusterName:              opt.ClusterName,
 		TargetNamespace:          opt.Namespace,
 		KubernetesVersion:        opt.KubernetesVersion,
@@ -425,33 +566,27 @@ func (c *ClusterApiClient) GenerateAwsWorkloadClusterYaml(opt option.GenerateAws
 		}
 	}
 
-	template, err := c.Client.GetClusterTemplate(context.Background(), templateOptions)
-	if err != nil {
-		return "", err
-	}
-
-	yaml, err := template.Yaml()
-	if err != nil {
-		return "", err
-	}
-
-	return string(yaml), nil
+	return c.getClusterTemplateYaml(ctx, templateOptions, variables)
 }
 
 func (c *ClusterApiClient) GenerateGkeWorkloadClusterYaml(opt option.GenerateGkeWorkloadClusterOption) (string, error) {
-	os.Setenv("GCP_CONTROL_PLANE_MACHINE_TYPE", opt.ControlPlaneMachineType)
-	os.Setenv("GCP_NODE_MACHINE_TYPE", opt.WorkerMachineType)
-	os.Setenv("KUBERNETES_VERSION", opt.KubernetesVersion)
-	os.Setenv("CLUSTER_NAME", opt.ClusterName)
-	os.Setenv("GCP_NETWORK_NAME", opt.NetworkName)
-	os.Setenv("GCP_PROJECT", opt.Project)
-	os.Setenv("GCP_REGION", opt.Region)
+	return c.GenerateGkeWorkloadClusterYamlWithContext(context.Background(), opt)
+}
+
+func (c *ClusterApiClient) GenerateGkeWorkloadClusterYamlWithContext(ctx context.Context, opt option.GenerateGkeWorkloadClusterOption) (string, error) {
+	variables := map[string]string{
+		"GCP_CONTROL_PLANE_MACHINE_TYPE": opt.ControlPlaneMachineType,
+		"GCP_NODE_MACHINE_TYPE":          opt.WorkerMachineType,
+		"KUBERNETES_VERSION":             opt.KubernetesVersion,
+		"CLUSTER_NAME":                   opt.ClusterName,
+		"GCP_NETWORK_NAME":               opt.NetworkName,
+		"GCP_PROJECT":                    opt.Project,
+		"GCP_REGION":                     opt.Region,
+	}
 
 	var controlMachineCount int64 = 1
 	templateOptions := client.GetClusterTemplateOptions{
-		Kubeconfig: client.Kubeconfig{
-			Path: c.KubeconfigFile,
-		},
+		Kubeconfig:               c.clusterctlKubeconfig(),
 		ClusterName:              opt.ClusterName,
 		TargetNamespace:          opt.Namespace,
 		KubernetesVersion:        opt.KubernetesVersion,
@@ -466,27 +601,154 @@ func (c *ClusterApiClient) GenerateGkeWorkloadClusterYaml(opt option.GenerateGke
 		}
 	}
 
-	template, err := c.Client.GetClusterTemplate(context.Background(), templateOptions)
+	return c.getClusterTemplateYaml(ctx, templateOptions, variables)
+}
+
+func (c *ClusterApiClient) GenerateAzureWorkloadClusterYaml(opt option.GenerateAzureWorkloadClusterOption) (string, error) {
+	return c.GenerateAzureWorkloadClusterYamlWithContext(context.Background(), opt)
+}
+
+func (c *ClusterApiClient) GenerateAzureWorkloadClusterYamlWithContext(ctx context.Context, opt option.GenerateAzureWorkloadClusterOption) (string, error) {
+	variables := map[string]string{
+		"AZURE_SUBSCRIPTION_ID":                   opt.SubscriptionID,
+		"AZURE_TENANT_ID":                         opt.TenantID,
+		"AZURE_CLIENT_ID":                         opt.ClientID,
+		"AZURE_LOCATION":                          opt.Location,
+		"AZURE_CONTROL_PLANE_MACHINE_TYPE":        opt.ControlPlaneMachineType,
+		"AZURE_NODE_MACHINE_TYPE":                 opt.NodeMachineType,
+		"AZURE_CLUSTER_IDENTITY_SECRET_NAME":      opt.ClusterIdentitySecretName,
+		"AZURE_CLUSTER_IDENTITY_SECRET_NAMESPACE": opt.ClusterIdentitySecretNamespace,
+		"CLUSTER_IDENTITY_NAME":                   opt.ClusterIdentityName,
+		"AZURE_SSH_PUBLIC_KEY_B64":                base64.StdEncoding.EncodeToString([]byte(opt.SshPublicKey)),
+		"KUBERNETES_VERSION":                      opt.KubernetesVersion,
+	}
+	if opt.ResourceGroup != "" {
+		variables["AZURE_RESOURCE_GROUP"] = opt.ResourceGroup
+	}
+
+	return c.getClusterTemplateYaml(ctx, c.providerTemplateOptions("azure", opt.ClusterName, opt.Namespace, opt.KubernetesVersion,
+		opt.ControlPlaneMachineCount, opt.WorkerMachineCount, opt.Flavor, opt.URL), variables)
+}
+
+func (c *ClusterApiClient) GenerateVSphereWorkloadClusterYaml(opt option.GenerateVSphereWorkloadClusterOption) (string, error) {
+	return c.GenerateVSphereWorkloadClusterYamlWithContext(context.Background(), opt)
+}
+
+func (c *ClusterApiClient) GenerateVSphereWorkloadClusterYamlWithContext(ctx context.Context, opt option.GenerateVSphereWorkloadClusterOption) (string, error) {
+	variables := map[string]string{
+		"VSPHERE_SERVER":             opt.Server,
+		"VSPHERE_USERNAME":           opt.Username,
+		"VSPHERE_PASSWORD":           opt.Password,
+		"VSPHERE_TLS_THUMBPRINT":     opt.TlsThumbprint,
+		"VSPHERE_DATACENTER":         opt.Datacenter,
+		"VSPHERE_DATASTORE":          opt.Datastore,
+		"VSPHERE_NETWORK":            opt.Network,
+		"VSPHERE_RESOURCE_POOL":      opt.ResourcePool,
+		"VSPHERE_FOLDER":             opt.Folder,
+		"VSPHERE_TEMPLATE":           opt.Template,
+		"VSPHERE_STORAGE_POLICY":     opt.StoragePolicy,
+		"VSPHERE_SSH_AUTHORIZED_KEY": opt.SshAuthorizedKey,
+		"CONTROL_PLANE_ENDPOINT_IP":  opt.ControlPlaneEndpointIP,
+		"KUBERNETES_VERSION":         opt.KubernetesVersion,
+	}
+	if opt.ControlPlaneEndpointPort != 0 {
+		variables["CONTROL_PLANE_ENDPOINT_PORT"] = fmt.Sprintf("%d", opt.ControlPlaneEndpointPort)
+	}
+
+	return c.getClusterTemplateYaml(ctx, c.providerTemplateOptions("vsphere", opt.ClusterName, opt.Namespace, opt.KubernetesVersion,
+		opt.ControlPlaneMachineCount, opt.WorkerMachineCount, opt.Flavor, opt.URL), variables)
+}
+
+func (c *ClusterApiClient) GenerateOpenstackWorkloadClusterYaml(opt option.GenerateOpenstackWorkloadClusterOption) (string, string, error) {
+	return c.GenerateOpenstackWorkloadClusterYamlWithContext(context.Background(), opt)
+}
+
+// GenerateOpenstackWorkloadClusterYamlWithContext returns the cluster YAML and the cloud.conf of
+// the OpenStack cloud provider generated from the clouds.yaml of opt, the process environment
+// is left untouched.
+func (c *ClusterApiClient) GenerateOpenstackWorkloadClusterYamlWithContext(ctx context.Context, opt option.GenerateOpenstackWorkloadClusterOption) (string, string, error) {
+	cloudsYaml := model.CloudsYaml{}
+	if err := cloudsYaml.Parse(opt.CloudsYaml); err != nil {
+		return "", "", err
+	}
+	if len(opt.SecureYaml) > 0 {
+		if err := cloudsYaml.MergeSecure(opt.SecureYaml); err != nil {
+			return "", "", err
+		}
+	}
+	if opt.Cloud != "" {
+		if err := cloudsYaml.SelectCloud(opt.Cloud); err != nil {
+			return "", "", err
+		}
+	}
+	variables, err := cloudsYaml.TemplateVariables(opt.OpenstackGenerateClusterOptions)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	yaml, err := template.Yaml()
+	clusterYaml, err := c.getClusterTemplateYaml(ctx, c.providerTemplateOptions("openstack", opt.ClusterName, opt.Namespace, opt.KubernetesVersion,
+		opt.ControlPlaneMachineCount, opt.WorkerMachineCount, opt.Flavor, opt.URL), variables)
 	if err != nil {
-		return "", err
+		return "", "", err
+	}
+
+	if len(opt.ManagedSubnets) > 0 {
+		// unlike UpdateYamlManifest, a patch that can't be applied fails the generation
+		clusterYaml, err = utils.PatchYamlManifest(clusterYaml, utils.ManifestOptionPatches(option.ManifestOption{
+			InfrastructureKindSpecOption: option.InfrastructureKindSpecOption{
+				ManagedSubnets: opt.ManagedSubnets,
+			},
+		}))
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	return clusterYaml, variables["OPENSTACK_CLOUD_PROVIDER_CONF"], nil
+}
+
+// providerTemplateOptions selects the template of an infrastructure provider repository, or
+// the template at url when it's set. The control plane machine count defaults to 1.
+func (c *ClusterApiClient) providerTemplateOptions(infrastructure, clusterName, namespace, kubernetesVersion string, controlPlaneMachineCount, workerMachineCount int64, flavor, url string) client.GetClusterTemplateOptions {
+	if controlPlaneMachineCount == 0 {
+		controlPlaneMachineCount = 1
+	}
+
+	templateOptions := client.GetClusterTemplateOptions{
+		Kubeconfig:               c.clusterctlKubeconfig(),
+		ClusterName:              clusterName,
+		TargetNamespace:          namespace,
+		KubernetesVersion:        kubernetesVersion,
+		WorkerMachineCount:       &workerMachineCount,
+		ControlPlaneMachineCount: &controlPlaneMachineCount,
+	}
+
+	if url != "" {
+		templateOptions.URLSource = &client.URLSourceOptions{
+			URL: url,
+		}
+	} else {
+		templateOptions.ProviderRepositorySource = &client.ProviderRepositorySourceOptions{
+			InfrastructureProvider: infrastructure,
+			Flavor:                 flavor,
+		}
 	}
 
-	return string(yaml), nil
+	return templateOptions
 }
 
 func (c *ClusterApiClient) GetWorkloadClusterKubeconfig(clusterName, namespace string) (*string, error) {
+	return c.GetWorkloadClusterKubeconfigWithContext(context.Background(), clusterName, namespace)
+}
+
+func (c *ClusterApiClient) GetWorkloadClusterKubeconfigWithContext(ctx context.Context, clusterName, namespace string) (*string, error) {
 	opt := client.GetKubeconfigOptions{
-		Kubeconfig:          client.Kubeconfig{Path: c.KubeconfigFile},
+		Kubeconfig:          c.clusterctlKubeconfig(),
 		WorkloadClusterName: clusterName,
 		Namespace:           namespace,
 	}
 
-	out, err := c.Client.GetKubeconfig(context.Background(), opt)
+	out, err := c.Client.GetKubeconfig(ctx, opt)
 	if err != nil {
 		return nil, err
 	}
@@ -495,41 +757,36 @@ func (c *ClusterApiClient) GetWorkloadClusterKubeconfig(clusterName, namespace s
 }
 
 func (c *ClusterApiClient) ApplyYaml(yamlString string) error {
-	var err error
-	decoder := yamlutil.NewYAMLOrJSONDecoder(bytes.NewReader([]byte(yamlString)), 100)
-	for {
-		var rawObj runtime.RawExtension
-		if err = decoder.Decode(&rawObj); err != nil {
-			break
-		}
+	return c.ApplyYamlWithContext(context.Background(), yamlString)
+}
 
-		dri, unstructuredObj, err := c.createDynamicResourceInterface(rawObj, "apply")
-		if err != nil {
-			c.LabelSelector = nil
-			return err
-		}
-		if dri == nil {
-			continue
-		}
+// ApplyYamlWithContext creates the objects of the manifest in dependency order, see
+// orderManifestObjects, and skips the ones that already exist. The custom resource
+// definitions of the manifest are waited for until they are established.
+func (c *ClusterApiClient) ApplyYamlWithContext(ctx context.Context, yamlString string) error {
+	defer func() { c.LabelSelector = nil }()
 
-		if _, err := (*dri).Create(context.Background(), unstructuredObj, metav1.CreateOptions{}); err != nil {
-			c.LabelSelector = nil
+	rawObjs, err := decodeYamlDocuments(yamlString)
+	if err != nil {
+		return err
+	}
+
+	return c.applyInOrder(ctx, rawObjs, "apply", func(dri dynamic.ResourceInterface, unstructuredObj *unstructured.Unstructured) error {
+		if _, err := dri.Create(ctx, unstructuredObj, metav1.CreateOptions{}); err != nil {
 			if strings.Contains(error.Error(err), ` already exists`) {
-				continue
+				return nil
 			}
 			return err
 		}
-	}
-	if err != io.EOF {
-		c.LabelSelector = nil
-		return err
-	}
-
-	c.LabelSelector = nil
-	return nil
+		return nil
+	})
 }
 
 func (c *ClusterApiClient) DeleteYaml(yamlString string) error {
+	return c.DeleteYamlWithContext(context.Background(), yamlString)
+}
+
+func (c *ClusterApiClient) DeleteYamlWithContext(ctx context.Context, yamlString string) error {
 	var err error
 	decoder := yamlutil.NewYAMLOrJSONDecoder(bytes.NewReader([]byte(yamlString)), 100)
 	for {
@@ -538,7 +795,7 @@ func (c *ClusterApiClient) DeleteYaml(yamlString string) error {
 			break
 		}
 
-		dri, unstructuredObj, err := c.createDynamicResourceInterface(rawObj, "delete")
+		dri, unstructuredObj, err := c.createDynamicResourceInterface(ctx, rawObj, "delete")
 		if err != nil {
 			c.LabelSelector = nil
 			if strings.Contains(error.Error(err), "no matches ") {
@@ -550,7 +807,7 @@ func (c *ClusterApiClient) DeleteYaml(yamlString string) error {
 			continue
 		}
 
-		if err := (*dri).Delete(context.Background(), unstructuredObj.GetName(), metav1.DeleteOptions{}); err != nil {
+		if err := (*dri).Delete(ctx, unstructuredObj.GetName(), metav1.DeleteOptions{}); err != nil {
 			c.LabelSelector = nil
 			if strings.Contains(error.Error(err), ` not found`) || strings.Contains(error.Error(err), "no matches ") {
 				continue
@@ -568,73 +825,92 @@ func (c *ClusterApiClient) DeleteYaml(yamlString string) error {
 }
 
 func (c *ClusterApiClient) ClusterApiReadiness() (bool, error) {
-	namespaces := []string{
-		"capi-kubeadm-bootstrap-system",
-		"capi-kubeadm-control-plane-system",
-		"capi-system",
+	return c.ClusterApiReadinessWithContext(context.Background())
+}
+
+// ClusterApiReadinessWithContext checks that the core, bootstrap and control plane providers
+// from the clusterctl inventory have all their Deployments available, falling back to
+// option.ClusterApiNamespaces for providers installed without clusterctl.
+func (c *ClusterApiClient) ClusterApiReadinessWithContext(ctx context.Context) (bool, error) {
+	inventory, err := c.listInventoryProviders(ctx)
+	if err != nil {
+		return false, err
 	}
-	readiness := true
+	if len(inventory.FilterCore()) == 0 {
+		for _, namespace := range option.ClusterApiNamespaces {
+			available, message, err := c.deploymentsAvailability(ctx, namespace, "")
+			if err != nil {
+				return false, err
+			}
+			if !available {
+				return false, fmt.Errorf("cluster-api provider is not available: %s", message)
+			}
+		}
+		return true, nil
+	}
+
+	for _, provider := range inventory.Items {
+		switch provider.GetProviderType() {
+		case clusterctlv1.CoreProviderType, clusterctlv1.BootstrapProviderType, clusterctlv1.ControlPlaneProviderType:
+		default:
+			continue
+		}
 
-	for _, ns := range namespaces {
-		pods, err := c.Clientset.CoreV1().Pods(ns).List(context.Background(), metav1.ListOptions{})
+		available, message, err := c.providerAvailability(ctx, provider)
 		if err != nil {
 			return false, err
 		}
-
-		for _, pod := range pods.Items {
-			for _, container := range pod.Status.ContainerStatuses {
-				if !container.Ready {
-					readiness = false
-					return readiness, fmt.Errorf("container %s's status in pod %s is not ready", container.Name, pod.Name)
-				}
-			}
-
-			if pod.Status.Phase != v1.PodRunning {
-				readiness = false
-				return readiness, fmt.Errorf("%s is currently %s", pod.Name, pod.Status.Phase)
-			}
+		if !available {
+			return false, fmt.Errorf("provider %s is not available: %s", provider.InstanceName(), message)
 		}
 	}
 
-	return readiness, nil
+	return true, nil
 }
 
 func (c *ClusterApiClient) InfrastructureReadiness(infrastructure string) (bool, error) {
-	namespace, ok := option.Namespaces[infrastructure]
-	if !ok {
-		return false, fmt.Errorf("this infrastructure is not available")
-	}
+	return c.InfrastructureReadinessWithContext(context.Background(), infrastructure)
+}
 
-	ns, err := c.Clientset.CoreV1().Namespaces().Get(context.Background(), namespace, metav1.GetOptions{})
+// InfrastructureReadinessWithContext finds the namespace of the infrastructure provider in the
+// clusterctl inventory, falling back to option.Namespaces for providers installed without clusterctl.
+func (c *ClusterApiClient) InfrastructureReadinessWithContext(ctx context.Context, infrastructure string) (bool, error) {
+	inventory, err := c.listInventoryProviders(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	pods, err := c.Clientset.CoreV1().Pods(ns.Name).List(context.Background(), metav1.ListOptions{})
-	if err != nil {
-		return false, err
-	}
+	providers := inventory.FilterByProviderNameAndType(infrastructure, clusterctlv1.InfrastructureProviderType)
+	if len(providers) == 0 {
+		namespace, ok := option.Namespaces[infrastructure]
+		if !ok {
+			return false, fmt.Errorf("infrastructure provider %s is not installed", infrastructure)
+		}
 
-	readiness := false
-	for _, pod := range pods.Items {
-		readiness = true
-		for _, container := range pod.Status.ContainerStatuses {
-			if !container.Ready {
-				readiness = false
-				return readiness, fmt.Errorf("container %s's status in pod %s is not ready", container.Name, pod.Name)
-			}
+		available, message, err := c.deploymentsAvailability(ctx, namespace, "")
+		if err != nil {
+			return false, err
 		}
+		if !available {
+			return false, fmt.Errorf("infrastructure provider %s is not available: %s", infrastructure, message)
+		}
+		return true, nil
+	}
 
-		if pod.Status.Phase != v1.PodRunning {
-			readiness = false
-			return readiness, fmt.Errorf("%s is currently %s", pod.Name, pod.Status.Phase)
+	for _, provider := range providers {
+		available, message, err := c.providerAvailability(ctx, provider)
+		if err != nil {
+			return false, err
+		}
+		if !available {
+			return false, fmt.Errorf("provider %s is not available: %s", provider.InstanceName(), message)
 		}
 	}
 
-	return readiness, nil
+	return true, nil
 }
 
-func (c *ClusterApiClient) createDynamicResourceInterface(rawObj runtime.RawExtension, action string) (*dynamic.ResourceInterface, *unstructured.Unstructured, error) {
+func (c *ClusterApiClient) createDynamicResourceInterface(ctx context.Context, rawObj runtime.RawExtension, action string) (*dynamic.ResourceInterface, *unstructured.Unstructured, error) {
 	obj, gvk, err := yamlserializer.NewDecodingSerializer(unstructured.UnstructuredJSONScheme).Decode(rawObj.Raw, nil, nil)
 	if err != nil {
 		return nil, nil, err
@@ -663,13 +939,7 @@ func (c *ClusterApiClient) createDynamicResourceInterface(rawObj runtime.RawExte
 		}
 	}
 
-	gr, err := restmapper.GetAPIGroupResources(c.Clientset.Discovery())
-	if err != nil {
-		return nil, nil, err
-	}
-
-	mapper := restmapper.NewDiscoveryRESTMapper(gr)
-	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	mapping, err := c.restMapping(*gvk)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -685,9 +955,12 @@ func (c *ClusterApiClient) createDynamicResourceInterface(rawObj runtime.RawExte
 			}
 			switch action {
 			case "apply":
-				err = c.ApplyYaml(yamlResult)
+				err = c.ApplyYamlWithContext(ctx, yamlResult)
 			case "delete":
-				err = c.DeleteYaml(yamlResult)
+				err = c.DeleteYamlWithContext(ctx, yamlResult)
+			default:
+				// the items need the options of the caller, decodeYamlDocuments flattens them first
+				err = fmt.Errorf("%s of a List document is not supported, split it into its items", action)
 			}
 			return nil, nil, err
 		}
@@ -706,8 +979,36 @@ func (c *ClusterApiClient) createDynamicResourceInterface(rawObj runtime.RawExte
 	return &dri, unstructuredObj, nil
 }
 
+func (c *ClusterApiClient) restMapping(gvk schema.GroupVersionKind) (*meta.RESTMapping, error) {
+	mapper := c.restMapper()
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		// the kind may have been registered after discovery was cached
+		mapper.Reset()
+		mapping, err = mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+
+	return mapping, err
+}
+
+// restMapper returns the REST mapper with the discovery of the current clientset cached.
+func (c *ClusterApiClient) restMapper() *restmapper.DeferredDiscoveryRESTMapper {
+	c.mapperMu.Lock()
+	defer c.mapperMu.Unlock()
+
+	if c.mapper == nil || c.mapperClientset != c.Clientset {
+		c.mapper = restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(c.Clientset.Discovery()))
+		c.mapperClientset = c.Clientset
+	}
+	return c.mapper
+}
+
 func (c *ClusterApiClient) CreateSecret(secret v1.Secret) (*v1.Secret, error) {
-	secretValue, err := c.Clientset.CoreV1().Secrets(secret.ObjectMeta.Namespace).Create(context.TODO(), &secret, metav1.CreateOptions{})
+	return c.CreateSecretWithContext(context.Background(), secret)
+}
+
+func (c *ClusterApiClient) CreateSecretWithContext(ctx context.Context, secret v1.Secret) (*v1.Secret, error) {
+	secretValue, err := c.Clientset.CoreV1().Secrets(secret.ObjectMeta.Namespace).Create(ctx, &secret, metav1.CreateOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -716,6 +1017,10 @@ func (c *ClusterApiClient) CreateSecret(secret v1.Secret) (*v1.Secret, error) {
 }
 
 func (c *ClusterApiClient) CreateDockerRegistrySecret(secretName, namespace string, args model.CreateDockerRegistrySecretArgs) (*v1.Secret, error) {
+	return c.CreateDockerRegistrySecretWithContext(context.Background(), secretName, namespace, args)
+}
+
+func (c *ClusterApiClient) CreateDockerRegistrySecretWithContext(ctx context.Context, secretName, namespace string, args model.CreateDockerRegistrySecretArgs) (*v1.Secret, error) {
 	secretObj := v1.Secret{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: v1.SchemeGroupVersion.String(),
@@ -748,7 +1053,7 @@ func (c *ClusterApiClient) CreateDockerRegistrySecret(secretName, namespace stri
 
 	secretObj.Data[v1.DockerConfigJsonKey] = b
 
-	secretValue, err := c.Clientset.CoreV1().Secrets(secretObj.ObjectMeta.Namespace).Create(context.TODO(), &secretObj, metav1.CreateOptions{})
+	secretValue, err := c.Clientset.CoreV1().Secrets(secretObj.ObjectMeta.Namespace).Create(ctx, &secretObj, metav1.CreateOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -757,10 +1062,18 @@ func (c *ClusterApiClient) CreateDockerRegistrySecret(secretName, namespace stri
 }
 
 func (c *ClusterApiClient) CreateNamespace(namespace string) (*v1.Namespace, error) {
-	return c.Clientset.CoreV1().Namespaces().Create(context.Background(), &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}, metav1.CreateOptions{})
+	return c.CreateNamespaceWithContext(context.Background(), namespace)
+}
+
+func (c *ClusterApiClient) CreateNamespaceWithContext(ctx context.Context, namespace string) (*v1.Namespace, error) {
+	return c.Clientset.CoreV1().Namespaces().Create(ctx, &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}, metav1.CreateOptions{})
 }
 
 func (c *ClusterApiClient) AddLabelNamespace(namespace, label, value string) (*v1.Namespace, error) {
+	return c.AddLabelNamespaceWithContext(context.Background(), namespace, label, value)
+}
+
+func (c *ClusterApiClient) AddLabelNamespaceWithContext(ctx context.Context, namespace, label, value string) (*v1.Namespace, error) {
 	type PatchStringValue struct {
 		Op    string `json:"op"`
 		Path  string `json:"path"`
@@ -772,11 +1085,15 @@ func (c *ClusterApiClient) AddLabelNamespace(namespace, label, value string) (*v
 		Value: value,
 	}}
 	b, _ := json.Marshal(payload)
-	return c.Clientset.CoreV1().Namespaces().Patch(context.Background(), namespace, types.JSONPatchType, b, metav1.PatchOptions{})
+	return c.Clientset.CoreV1().Namespaces().Patch(ctx, namespace, types.JSONPatchType, b, metav1.PatchOptions{})
 }
 
 func (c *ClusterApiClient) GetService(serviceName, namespace string) (*v1.Service, error) {
-	service, err := c.Clientset.CoreV1().Services(namespace).Get(context.Background(), serviceName, metav1.GetOptions{})
+	return c.GetServiceWithContext(context.Background(), serviceName, namespace)
+}
+
+func (c *ClusterApiClient) GetServiceWithContext(ctx context.Context, serviceName, namespace string) (*v1.Service, error) {
+	service, err := c.Clientset.CoreV1().Services(namespace).Get(ctx, serviceName, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -785,7 +1102,11 @@ func (c *ClusterApiClient) GetService(serviceName, namespace string) (*v1.Servic
 }
 
 func (c *ClusterApiClient) GetSecret(secretName, namespace string) (*v1.Secret, error) {
-	secret, err := c.Clientset.CoreV1().Secrets(namespace).Get(context.Background(), secretName, metav1.GetOptions{})
+	return c.GetSecretWithContext(context.Background(), secretName, namespace)
+}
+
+func (c *ClusterApiClient) GetSecretWithContext(ctx context.Context, secretName, namespace string) (*v1.Secret, error) {
+	secret, err := c.Clientset.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -794,53 +1115,85 @@ func (c *ClusterApiClient) GetSecret(secretName, namespace string) (*v1.Secret,
 }
 
 func (c *ClusterApiClient) PatchServiceAccount(name, namespace string, patch []byte) (*v1.ServiceAccount, error) {
-	sa, err := c.Clientset.CoreV1().ServiceAccounts(namespace).Patch(context.Background(), name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	return c.PatchServiceAccountWithContext(context.Background(), name, namespace, patch)
+}
+
+func (c *ClusterApiClient) PatchServiceAccountWithContext(ctx context.Context, name, namespace string, patch []byte) (*v1.ServiceAccount, error) {
+	sa, err := c.Clientset.CoreV1().ServiceAccounts(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
 
 	return sa, err
 }
 
 func (c *ClusterApiClient) PatchConfigMap(name, namespace string, patch []byte) (*v1.ConfigMap, error) {
-	cm, err := c.Clientset.CoreV1().ConfigMaps(namespace).Patch(context.Background(), name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	return c.PatchConfigMapWithContext(context.Background(), name, namespace, patch)
+}
+
+func (c *ClusterApiClient) PatchConfigMapWithContext(ctx context.Context, name, namespace string, patch []byte) (*v1.ConfigMap, error) {
+	cm, err := c.Clientset.CoreV1().ConfigMaps(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
 
 	return cm, err
 }
 
 func (c *ClusterApiClient) UpdateSecret(namespace string, secret *v1.Secret) (*v1.Secret, error) {
-	sc, err := c.Clientset.CoreV1().Secrets(namespace).Update(context.Background(), secret, metav1.UpdateOptions{})
+	return c.UpdateSecretWithContext(context.Background(), namespace, secret)
+}
+
+func (c *ClusterApiClient) UpdateSecretWithContext(ctx context.Context, namespace string, secret *v1.Secret) (*v1.Secret, error) {
+	sc, err := c.Clientset.CoreV1().Secrets(namespace).Update(ctx, secret, metav1.UpdateOptions{})
 
 	return sc, err
 }
 
 func (c *ClusterApiClient) DeleteCluster(clusterName, namespace string) ([]byte, error) {
+	return c.DeleteClusterWithContext(context.Background(), clusterName, namespace)
+}
+
+func (c *ClusterApiClient) DeleteClusterWithContext(ctx context.Context, clusterName, namespace string) ([]byte, error) {
 	return c.Clientset.RESTClient().Delete().
 		AbsPath("apis/cluster.x-k8s.io/v1beta1/namespaces/"+namespace+"/clusters/"+clusterName).
 		VersionedParams(&metav1.GetOptions{}, metav1.ParameterCodec).
-		DoRaw(context.TODO())
+		DoRaw(ctx)
 }
 
 func (c *ClusterApiClient) GetKNativeRevision(revisionName, namespace string) ([]byte, error) {
+	return c.GetKNativeRevisionWithContext(context.Background(), revisionName, namespace)
+}
+
+func (c *ClusterApiClient) GetKNativeRevisionWithContext(ctx context.Context, revisionName, namespace string) ([]byte, error) {
 	return c.Clientset.RESTClient().Get().
 		AbsPath("apis/serving.knative.dev/v1/namespaces/"+namespace+"/revisions/"+revisionName).
 		VersionedParams(&metav1.GetOptions{}, metav1.ParameterCodec).
-		DoRaw(context.TODO())
+		DoRaw(ctx)
 }
 
 func (c *ClusterApiClient) GetKNativeConfiguration(configurationName, namespace string) ([]byte, error) {
+	return c.GetKNativeConfigurationWithContext(context.Background(), configurationName, namespace)
+}
+
+func (c *ClusterApiClient) GetKNativeConfigurationWithContext(ctx context.Context, configurationName, namespace string) ([]byte, error) {
 	return c.Clientset.RESTClient().Get().
 		AbsPath("apis/serving.knative.dev/v1/namespaces/"+namespace+"/configurations/"+configurationName).
 		VersionedParams(&metav1.GetOptions{}, metav1.ParameterCodec).
-		DoRaw(context.TODO())
+		DoRaw(ctx)
 }
 
 func (c *ClusterApiClient) GetClusterK8sResource(clusterName, namespace string) ([]byte, error) {
+	return c.GetClusterK8sResourceWithContext(context.Background(), clusterName, namespace)
+}
+
+func (c *ClusterApiClient) GetClusterK8sResourceWithContext(ctx context.Context, clusterName, namespace string) ([]byte, error) {
 	return c.Clientset.RESTClient().Get().
 		AbsPath("apis/cluster.x-k8s.io/v1beta1/namespaces/"+namespace+"/clusters/"+clusterName).
 		VersionedParams(&metav1.GetOptions{}, metav1.ParameterCodec).
-		DoRaw(context.TODO())
+		DoRaw(ctx)
 }
 
 func (c *ClusterApiClient) GetDeployment(deploymentName, namespace string) (*appsv1.Deployment, error) {
-	deployment, err := c.Clientset.AppsV1().Deployments(namespace).Get(context.Background(), deploymentName, metav1.GetOptions{})
+	return c.GetDeploymentWithContext(context.Background(), deploymentName, namespace)
+}
+
+func (c *ClusterApiClient) GetDeploymentWithContext(ctx context.Context, deploymentName, namespace string) (*appsv1.Deployment, error) {
+	deployment, err := c.Clientset.AppsV1().Deployments(namespace).Get(ctx, deploymentName, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -849,7 +1202,11 @@ func (c *ClusterApiClient) GetDeployment(deploymentName, namespace string) (*app
 }
 
 func (c *ClusterApiClient) RestartDeployment(deploymentName, namespace string) (*appsv1.Deployment, error) {
-	deployment, err := c.Clientset.AppsV1().Deployments(namespace).Get(context.Background(), deploymentName, metav1.GetOptions{})
+	return c.RestartDeploymentWithContext(context.Background(), deploymentName, namespace)
+}
+
+func (c *ClusterApiClient) RestartDeploymentWithContext(ctx context.Context, deploymentName, namespace string) (*appsv1.Deployment, error) {
+	deployment, err := c.Clientset.AppsV1().Deployments(namespace).Get(ctx, deploymentName, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -872,7 +1229,7 @@ func (c *ClusterApiClient) RestartDeployment(deploymentName, namespace string) (
 			})
 	}
 
-	_, err = c.Clientset.AppsV1().Deployments(namespace).Update(context.TODO(), deployment, metav1.UpdateOptions{})
+	_, err = c.Clientset.AppsV1().Deployments(namespace).Update(ctx, deployment, metav1.UpdateOptions{})
 	if err != nil {
 		panic(err.Error())
 	}
@@ -882,6 +1239,10 @@ func (c *ClusterApiClient) RestartDeployment(deploymentName, namespace string) (
 
 // https://stackoverflow.com/questions/65927298/patching-a-pvc-using-go-client
 func (c *ClusterApiClient) UpdateClusterK8sResourceAnnotations(clusterName, namespace string, patchValues interface{}) (*unstructured.Unstructured, error) {
+	return c.UpdateClusterK8sResourceAnnotationsWithContext(context.Background(), clusterName, namespace, patchValues)
+}
+
+func (c *ClusterApiClient) UpdateClusterK8sResourceAnnotationsWithContext(ctx context.Context, clusterName, namespace string, patchValues interface{}) (*unstructured.Unstructured, error) {
 	patch := []struct {
 		Op    string      `json:"op"`
 		Path  string      `json:"path"`
@@ -919,10 +1280,14 @@ func (c *ClusterApiClient) UpdateClusterK8sResourceAnnotations(clusterName, name
 
 	return c.DynamicInterface.Resource(resource).
 		Namespace(namespace).
-		Patch(context.TODO(), clusterName, types.JSONPatchType, b, metav1.PatchOptions{})
+		Patch(ctx, clusterName, types.JSONPatchType, b, metav1.PatchOptions{})
 }
 
 func (c *ClusterApiClient) ExecuteNodeShellCommand(nodeName, command string) (string, error) {
+	return c.ExecuteNodeShellCommandWithContext(context.Background(), nodeName, command)
+}
+
+func (c *ClusterApiClient) ExecuteNodeShellCommandWithContext(ctx context.Context, nodeName, command string) (string, error) {
 	const charset = "abcdefghijklmnopqrstuvwxyz"
 	var seededRand = rand.New(rand.NewSource(time.Now().UnixNano()))
 
@@ -983,7 +1348,7 @@ func (c *ClusterApiClient) ExecuteNodeShellCommand(nodeName, command string) (st
 	}
 
 	// Create the Job
-	_, err := c.Clientset.BatchV1().Jobs(namespace).Create(context.Background(), &jobSpec, metav1.CreateOptions{})
+	_, err := c.Clientset.BatchV1().Jobs(namespace).Create(ctx, &jobSpec, metav1.CreateOptions{})
 	if err != nil {
 		if !strings.Contains(err.Error(), " already exists") {
 			return "", err
@@ -991,8 +1356,8 @@ func (c *ClusterApiClient) ExecuteNodeShellCommand(nodeName, command string) (st
 	}
 
 	// Wait for the Job to complete
-	err = wait.PollImmediate(3*time.Second, 2*time.Minute, func() (bool, error) {
-		job, err := c.Clientset.BatchV1().Jobs(namespace).Get(context.Background(), jobName, metav1.GetOptions{})
+	err = wait.PollUntilContextTimeout(ctx, 3*time.Second, 2*time.Minute, true, func(ctx context.Context) (bool, error) {
+		job, err := c.Clientset.BatchV1().Jobs(namespace).Get(ctx, jobName, metav1.GetOptions{})
 		if err != nil {
 			if k8serrors.IsNotFound(err) {
 				fmt.Printf("Job %s not created yet...\n", jobName)
@@ -1019,7 +1384,7 @@ func (c *ClusterApiClient) ExecuteNodeShellCommand(nodeName, command string) (st
 	}
 
 	// Retrieve logs from the job's pod
-	pods, err := c.Clientset.CoreV1().Pods(namespace).List(context.Background(), metav1.ListOptions{
+	pods, err := c.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
 		LabelSelector: fmt.Sprintf("job-name=%s", jobName),
 	})
 	if err != nil || len(pods.Items) == 0 {
@@ -1031,14 +1396,14 @@ func (c *ClusterApiClient) ExecuteNodeShellCommand(nodeName, command string) (st
 	})
 
 	podName := pods.Items[0].Name
-	logs, err := c.GetPodLogs(namespace, podName)
+	logs, err := c.GetPodLogsWithContext(ctx, namespace, podName)
 	if err != nil {
 		return "", err
 	}
 
 	// Cleanup the job after execution
 	deletePolicy := metav1.DeletePropagationForeground
-	err = c.Clientset.BatchV1().Jobs(namespace).Delete(context.Background(), jobName, metav1.DeleteOptions{
+	err = c.Clientset.BatchV1().Jobs(namespace).Delete(ctx, jobName, metav1.DeleteOptions{
 		PropagationPolicy: &deletePolicy,
 	})
 	if err != nil {
@@ -1049,21 +1414,27 @@ func (c *ClusterApiClient) ExecuteNodeShellCommand(nodeName, command string) (st
 }
 
 func (c *ClusterApiClient) GetPodLogs(namespace, podName string) (string, error) {
+	return c.GetPodLogsWithContext(context.Background(), namespace, podName)
+}
+
+func (c *ClusterApiClient) GetPodLogsWithContext(ctx context.Context, namespace, podName string) (string, error) {
 	const maxAttempts = 3
 	const retryDelay = 5 * time.Second
 
 	var lastErr error
 
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		attemptCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 		defer cancel()
 
 		req := c.Clientset.CoreV1().Pods(namespace).GetLogs(podName, &v1.PodLogOptions{})
-		logs, err := req.Stream(ctx)
+		logs, err := req.Stream(attemptCtx)
 		if err != nil {
 			log.Printf("Attempt %d: Error getting stream for pod %s: %v\n", attempt, podName, err)
 			lastErr = err
-			time.Sleep(retryDelay)
+			if err := sleepWithContext(ctx, retryDelay); err != nil {
+				return "", err
+			}
 			continue
 		}
 		defer logs.Close()
@@ -1073,7 +1444,9 @@ func (c *ClusterApiClient) GetPodLogs(namespace, podName string) (string, error)
 		if err != nil {
 			log.Printf("Attempt %d: Error copying log buffer for pod %s: %v\n", attempt, podName, err)
 			lastErr = err
-			time.Sleep(retryDelay)
+			if err := sleepWithContext(ctx, retryDelay); err != nil {
+				return "", err
+			}
 			continue
 		}
 
@@ -1087,20 +1460,28 @@ func (c *ClusterApiClient) GetPodLogs(namespace, podName string) (string, error)
 }
 
 func (c *ClusterApiClient) DescribeCluster(clusterName, namespace string) (*tree.ObjectTree, error) {
-	objTree, err := c.Client.DescribeCluster(context.Background(), client.DescribeClusterOptions{
-		Namespace:   clusterName,
-		ClusterName: namespace,
-		Kubeconfig:  client.Kubeconfig{Path: c.KubeconfigFile},
+	return c.DescribeClusterWithContext(context.Background(), clusterName, namespace)
+}
+
+func (c *ClusterApiClient) DescribeClusterWithContext(ctx context.Context, clusterName, namespace string) (*tree.ObjectTree, error) {
+	objTree, err := c.Client.DescribeCluster(ctx, client.DescribeClusterOptions{
+		Namespace:   namespace,
+		ClusterName: clusterName,
+		Kubeconfig:  c.clusterctlKubeconfig(),
 	})
 
 	return objTree, err
 }
 
 func (c *ClusterApiClient) GetWorkloadClusterMachines(clusterName, namespace string) ([]model.CRDResource, error) {
+	return c.GetWorkloadClusterMachinesWithContext(context.Background(), clusterName, namespace)
+}
+
+func (c *ClusterApiClient) GetWorkloadClusterMachinesWithContext(ctx context.Context, clusterName, namespace string) ([]model.CRDResource, error) {
 	b, err := c.Clientset.RESTClient().Get().
 		AbsPath("apis/cluster.x-k8s.io/v1beta1/namespaces/"+namespace+"/machines").
-		VersionedParams(&metav1.GetOptions{}, metav1.ParameterCodec).
-		DoRaw(context.TODO())
+		VersionedParams(&metav1.ListOptions{LabelSelector: ClusterLabelSelector(clusterName)}, metav1.ParameterCodec).
+		DoRaw(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -1117,12 +1498,17 @@ func (c *ClusterApiClient) GetWorkloadClusterMachines(clusterName, namespace str
 		return nil, err
 	}
 
-	filteredMachines := []model.CRDResource{}
-	for _, machine := range machines {
-		if machine.Metadata.Labels["cluster.x-k8s.io/cluster-name"] == clusterName {
-			filteredMachines = append(filteredMachines, machine)
-		}
-	}
+	return machines, nil
+}
+
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
 
-	return filteredMachines, nil
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
@@ -0,0 +1,341 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/LyridInc/cluster-api-go-sdk/model"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+type DeleteClusterOptions struct {
+	// Timeout bounds the wait for the Cluster object to disappear, defaults to 30 minutes.
+	Timeout time.Duration
+	// PollInterval defaults to 10 seconds.
+	PollInterval time.Duration
+	// WorkloadCleanupTimeout bounds the wait for load balancers and volumes to be released, defaults to 10 minutes.
+	WorkloadCleanupTimeout     time.Duration
+	SkipWorkloadCleanup        bool
+	KeepPersistentVolumeClaims bool
+	// OnProgress is called with the current report after every step and poll.
+	OnProgress func(model.ClusterDeletionReport)
+}
+
+// DeleteClusterAndWait removes the LoadBalancer Services and the PersistentVolumeClaims no pod
+// mounts from the workload cluster so the cloud provider releases load balancers, floating IPs
+// and volumes, then deletes the Cluster and waits until it's gone. The report lists the objects still
+// blocking the deletion when it times out.
+func (c *ClusterApiClient) DeleteClusterAndWait(ctx context.Context, clusterName, namespace string, opt DeleteClusterOptions) (*model.ClusterDeletionReport, error) {
+	if opt.Timeout == 0 {
+		opt.Timeout = 30 * time.Minute
+	}
+	if opt.PollInterval == 0 {
+		opt.PollInterval = 10 * time.Second
+	}
+	if opt.WorkloadCleanupTimeout == 0 {
+		opt.WorkloadCleanupTimeout = 10 * time.Minute
+	}
+
+	report := &model.ClusterDeletionReport{
+		ClusterName:  clusterName,
+		Namespace:    namespace,
+		StuckObjects: []model.StuckObject{},
+	}
+	notify := func() {
+		if opt.OnProgress != nil {
+			opt.OnProgress(*report)
+		}
+	}
+
+	if !opt.SkipWorkloadCleanup {
+		c.cleanupWorkloadCluster(ctx, clusterName, namespace, opt, &report.WorkloadCleanup)
+		notify()
+	}
+	defer func() {
+		if report.Deleted {
+			c.ForgetWorkloadClient(clusterName, namespace)
+		}
+	}()
+
+	if _, err := c.DeleteClusterWithContext(ctx, clusterName, namespace); err != nil {
+		if k8serrors.IsNotFound(err) {
+			report.Deleted = true
+			notify()
+			return report, nil
+		}
+		return report, err
+	}
+
+	err := wait.PollUntilContextTimeout(ctx, opt.PollInterval, opt.Timeout, true, func(ctx context.Context) (bool, error) {
+		cluster, err := c.DynamicInterface.Resource(clusterResource).Namespace(namespace).Get(ctx, clusterName, metav1.GetOptions{})
+		if err != nil {
+			if k8serrors.IsNotFound(err) {
+				report.Deleted = true
+				report.StuckObjects = []model.StuckObject{}
+				notify()
+				return true, nil
+			}
+			return false, err
+		}
+
+		stuckObjects, err := c.clusterDeletionBlockers(ctx, cluster)
+		if err != nil {
+			return false, err
+		}
+		report.StuckObjects = stuckObjects
+		notify()
+		return false, nil
+	})
+	if err != nil {
+		if wait.Interrupted(err) {
+			return report, fmt.Errorf("%w: %s/%s: %w", ErrClusterDeletion, namespace, clusterName, err)
+		}
+		return report, err
+	}
+
+	return report, nil
+}
+
+// cleanupWorkloadCluster is best effort, failures are recorded in the report because an
+// unreachable workload cluster must not prevent the deletion of its infrastructure.
+func (c *ClusterApiClient) cleanupWorkloadCluster(ctx context.Context, clusterName, namespace string, opt DeleteClusterOptions, cleanup *model.WorkloadCleanup) {
+	cleanup.DeletedServices = []string{}
+	cleanup.DeletedPersistentVolumeClaims = []string{}
+	addError := func(err error) {
+		cleanup.Errors = append(cleanup.Errors, err.Error())
+	}
+
+	workload, _, err := c.WorkloadClient(ctx, clusterName, namespace)
+	if err != nil {
+		addError(err)
+		return
+	}
+	clientset := workload.Clientset
+
+	services, err := clientset.CoreV1().Services("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		addError(err)
+		return
+	}
+	for _, service := range services.Items {
+		if service.Spec.Type != v1.ServiceTypeLoadBalancer {
+			continue
+		}
+		if err := clientset.CoreV1().Services(service.Namespace).Delete(ctx, service.Name, metav1.DeleteOptions{}); err != nil && !k8serrors.IsNotFound(err) {
+			addError(err)
+			continue
+		}
+		cleanup.DeletedServices = append(cleanup.DeletedServices, service.Namespace+"/"+service.Name)
+	}
+
+	// only volumes with the Delete reclaim policy are released by the provisioner
+	volumes := []string{}
+	if !opt.KeepPersistentVolumeClaims {
+		pvcs, err := clientset.CoreV1().PersistentVolumeClaims("").List(ctx, metav1.ListOptions{})
+		if err != nil {
+			addError(err)
+			return
+		}
+		claimPods, err := persistentVolumeClaimPods(ctx, clientset)
+		if err != nil {
+			addError(err)
+			return
+		}
+		for _, pvc := range pvcs.Items {
+			// the pvc-protection finalizer keeps a mounted claim and its volume until the pods are gone
+			key := pvc.Namespace + "/" + pvc.Name
+			if pods, ok := claimPods[key]; ok {
+				if cleanup.InUsePersistentVolumeClaims == nil {
+					cleanup.InUsePersistentVolumeClaims = map[string][]string{}
+				}
+				cleanup.InUsePersistentVolumeClaims[key] = pods
+				continue
+			}
+			if pvc.Spec.VolumeName != "" {
+				pv, err := clientset.CoreV1().PersistentVolumes().Get(ctx, pvc.Spec.VolumeName, metav1.GetOptions{})
+				if err == nil && pv.Spec.PersistentVolumeReclaimPolicy == v1.PersistentVolumeReclaimDelete {
+					volumes = append(volumes, pv.Name)
+				}
+			}
+			if err := clientset.CoreV1().PersistentVolumeClaims(pvc.Namespace).Delete(ctx, pvc.Name, metav1.DeleteOptions{}); err != nil && !k8serrors.IsNotFound(err) {
+				addError(err)
+				continue
+			}
+			cleanup.DeletedPersistentVolumeClaims = append(cleanup.DeletedPersistentVolumeClaims, pvc.Namespace+"/"+pvc.Name)
+		}
+	}
+
+	err = wait.PollUntilContextTimeout(ctx, opt.PollInterval, opt.WorkloadCleanupTimeout, true, func(ctx context.Context) (bool, error) {
+		remainingServices, remainingVolumes, err := remainingWorkloadResources(ctx, clientset, volumes)
+		if err != nil {
+			return false, err
+		}
+		cleanup.RemainingServices = remainingServices
+		cleanup.RemainingPersistentVolumes = remainingVolumes
+		return len(remainingServices) == 0 && len(remainingVolumes) == 0, nil
+	})
+	if err != nil {
+		addError(fmt.Errorf("waiting for load balancers and volumes to be released: %w", err))
+	}
+}
+
+// persistentVolumeClaimPods returns the pods of every claim mounted by a pod that isn't terminated.
+func persistentVolumeClaimPods(ctx context.Context, clientset *kubernetes.Clientset) (map[string][]string, error) {
+	pods, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	claimPods := map[string][]string{}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim == nil {
+				continue
+			}
+			key := pod.Namespace + "/" + volume.PersistentVolumeClaim.ClaimName
+			claimPods[key] = append(claimPods[key], pod.Name)
+		}
+	}
+	return claimPods, nil
+}
+
+func remainingWorkloadResources(ctx context.Context, clientset *kubernetes.Clientset, volumes []string) ([]string, []string, error) {
+	remainingServices := []string{}
+	services, err := clientset.CoreV1().Services("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, service := range services.Items {
+		if service.Spec.Type == v1.ServiceTypeLoadBalancer {
+			remainingServices = append(remainingServices, service.Namespace+"/"+service.Name)
+		}
+	}
+
+	remainingVolumes := []string{}
+	for _, volume := range volumes {
+		_, err := clientset.CoreV1().PersistentVolumes().Get(ctx, volume, metav1.GetOptions{})
+		if err == nil {
+			remainingVolumes = append(remainingVolumes, volume)
+		} else if !k8serrors.IsNotFound(err) {
+			return nil, nil, err
+		}
+	}
+
+	return remainingServices, remainingVolumes, nil
+}
+
+// clusterDeletionBlockers returns the Cluster, its infrastructure and control plane objects,
+// and its machines with their infrastructure machines that still exist.
+func (c *ClusterApiClient) clusterDeletionBlockers(ctx context.Context, cluster *unstructured.Unstructured) ([]model.StuckObject, error) {
+	stuckObjects := []model.StuckObject{newStuckObject(cluster)}
+	namespace := cluster.GetNamespace()
+
+	for _, field := range []string{"infrastructureRef", "controlPlaneRef"} {
+		ref, found, _ := unstructured.NestedMap(cluster.Object, "spec", field)
+		if !found {
+			continue
+		}
+		obj, err := c.getReferencedObject(ctx, ref, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if obj != nil {
+			stuckObjects = append(stuckObjects, newStuckObject(obj))
+		}
+	}
+
+	machines, err := c.DynamicInterface.Resource(machineResource).Namespace(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: ClusterLabelSelector(cluster.GetName()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range machines.Items {
+		machine := &machines.Items[i]
+		stuckObjects = append(stuckObjects, newStuckObject(machine))
+
+		ref, found, _ := unstructured.NestedMap(machine.Object, "spec", "infrastructureRef")
+		if !found {
+			continue
+		}
+		obj, err := c.getReferencedObject(ctx, ref, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if obj != nil {
+			stuckObjects = append(stuckObjects, newStuckObject(obj))
+		}
+	}
+
+	return stuckObjects, nil
+}
+
+// getReferencedObject returns nil without an error when the referenced object doesn't exist.
+func (c *ClusterApiClient) getReferencedObject(ctx context.Context, ref map[string]interface{}, namespace string) (*unstructured.Unstructured, error) {
+	apiVersion, _, _ := unstructured.NestedString(ref, "apiVersion")
+	kind, _, _ := unstructured.NestedString(ref, "kind")
+	name, _, _ := unstructured.NestedString(ref, "name")
+	if refNamespace, _, _ := unstructured.NestedString(ref, "namespace"); refNamespace != "" {
+		namespace = refNamespace
+	}
+
+	mapping, err := c.restMapping(schema.FromAPIVersionAndKind(apiVersion, kind))
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := c.DynamicInterface.Resource(mapping.Resource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// newStuckObject explains why an object is still present using its failure fields,
+// or the Ready condition, or the first condition that is not true.
+func newStuckObject(obj *unstructured.Unstructured) model.StuckObject {
+	stuckObject := model.StuckObject{
+		ApiVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Name:       obj.GetName(),
+		Namespace:  obj.GetNamespace(),
+		Finalizers: obj.GetFinalizers(),
+	}
+	if deletionTimestamp := obj.GetDeletionTimestamp(); deletionTimestamp != nil {
+		stuckObject.DeletionTimestamp = &deletionTimestamp.Time
+	}
+
+	stuckObject.Reason, _, _ = unstructured.NestedString(obj.Object, "status", "failureReason")
+	stuckObject.Message, _, _ = unstructured.NestedString(obj.Object, "status", "failureMessage")
+	if stuckObject.Reason != "" || stuckObject.Message != "" {
+		return stuckObject
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["status"] == string(v1.ConditionTrue) {
+			continue
+		}
+		if stuckObject.Reason == "" || condition["type"] == "Ready" {
+			stuckObject.Reason, _ = condition["reason"].(string)
+			stuckObject.Message, _ = condition["message"].(string)
+		}
+	}
+
+	return stuckObject
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/LyridInc/cluster-api-go-sdk/model"
+	corev1 "k8s.io/api/core/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/cmd/clusterctl/client"
+	"sigs.k8s.io/cluster-api/cmd/clusterctl/client/tree"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DescribeClusterReport returns the clusterctl describe tree of a cluster as plain structs
+// together with the flattened list of objects whose Ready condition isn't true.
+func (c *ClusterApiClient) DescribeClusterReport(ctx context.Context, clusterName, namespace string) (*model.ClusterStatusReport, error) {
+	objTree, err := c.Client.DescribeCluster(ctx, client.DescribeClusterOptions{
+		Namespace:               namespace,
+		ClusterName:             clusterName,
+		Kubeconfig:              c.clusterctlKubeconfig(),
+		ShowOtherConditions:     "all",
+		ShowMachineSets:         true,
+		ShowClusterResourceSets: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &model.ClusterStatusReport{
+		ClusterName: clusterName,
+		Namespace:   namespace,
+		Unhealthy:   []model.UnhealthyObject{},
+	}
+	report.Tree = newClusterStatusNode(objTree, objTree.GetRoot(), nil, &report.Unhealthy)
+	report.Ready = report.Tree.Ready
+
+	return report, nil
+}
+
+func newClusterStatusNode(objTree *tree.ObjectTree, obj ctrlclient.Object, parentPath []string, unhealthy *[]model.UnhealthyObject) model.ClusterStatusNode {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	node := model.ClusterStatusNode{
+		ApiVersion:  gvk.GroupVersion().String(),
+		Kind:        gvk.Kind,
+		Name:        obj.GetName(),
+		Namespace:   obj.GetNamespace(),
+		DisplayName: tree.GetMetaName(obj),
+		Virtual:     tree.IsVirtualObject(obj),
+		Group:       tree.IsGroupObject(obj),
+	}
+	if node.Virtual {
+		node.ApiVersion = ""
+	}
+	if node.Group {
+		node.GroupItems = strings.Split(tree.GetGroupItems(obj), tree.GroupItemsSeparator)
+	}
+
+	displayName := node.DisplayName
+	if displayName == "" {
+		displayName = node.Kind + "/" + node.Name
+	}
+	path := append(append([]string{}, parentPath...), displayName)
+
+	// objects without a Ready condition, e.g. virtual nodes, don't count as unhealthy
+	node.Ready = true
+	if ready := tree.GetReadyCondition(obj); ready != nil {
+		condition := newClusterStatusCondition(ready)
+		node.Ready = ready.Status == corev1.ConditionTrue
+		node.Status = condition.Status
+		node.Severity = condition.Severity
+		node.Reason = condition.Reason
+		node.Message = condition.Message
+		node.LastTransitionTime = condition.LastTransitionTime
+
+		if !node.Ready {
+			*unhealthy = append(*unhealthy, model.UnhealthyObject{
+				Path:               path,
+				ApiVersion:         node.ApiVersion,
+				Kind:               node.Kind,
+				Name:               node.Name,
+				Namespace:          node.Namespace,
+				Status:             node.Status,
+				Severity:           node.Severity,
+				Reason:             node.Reason,
+				Message:            node.Message,
+				LastTransitionTime: node.LastTransitionTime,
+			})
+		}
+	}
+	for _, condition := range tree.GetOtherConditions(obj) {
+		node.Conditions = append(node.Conditions, newClusterStatusCondition(condition))
+	}
+
+	// same order as clusterctl describe: highest z-order first, then by name
+	children := objTree.GetObjectsByParent(obj.GetUID())
+	sort.SliceStable(children, func(i, j int) bool {
+		if zi, zj := tree.GetZOrder(children[i]), tree.GetZOrder(children[j]); zi != zj {
+			return zi > zj
+		}
+		return children[i].GetName() < children[j].GetName()
+	})
+	for _, child := range children {
+		node.Children = append(node.Children, newClusterStatusNode(objTree, child, path, unhealthy))
+	}
+
+	return node
+}
+
+func newClusterStatusCondition(condition *clusterv1.Condition) model.ClusterStatusCondition {
+	statusCondition := model.ClusterStatusCondition{
+		Type:     string(condition.Type),
+		Status:   string(condition.Status),
+		Severity: string(condition.Severity),
+		Reason:   condition.Reason,
+		Message:  condition.Message,
+	}
+	if !condition.LastTransitionTime.IsZero() {
+		statusCondition.LastTransitionTime = &condition.LastTransitionTime.Time
+	}
+
+	return statusCondition
+}
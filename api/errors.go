@@ -0,0 +1,17 @@
+package api
+
+import "errors"
+
+var (
+	ErrInvalidKubeconfig        = errors.New("invalid kubeconfig")
+	ErrClusterctlConfig         = errors.New("invalid clusterctl config")
+	ErrKubernetesClient         = errors.New("kubernetes client error")
+	ErrInvalidReplicas          = errors.New("invalid replicas")
+	ErrInvalidUpgrade           = errors.New("invalid upgrade")
+	ErrClusterDeletion          = errors.New("cluster deletion is stuck")
+	ErrMoveTargetNotReady       = errors.New("move target is not ready")
+	ErrProviderNotAvailable     = errors.New("provider is not available")
+	ErrMissingTemplateVariables = errors.New("missing template variables")
+	ErrInvalidTopology          = errors.New("invalid cluster topology")
+	ErrCRDNotEstablished        = errors.New("custom resource definition is not established")
+)
@@ -114,6 +114,41 @@ func NewHelmClientFromConfigBytes(configBytes []byte, namespace string) (*HelmCl
 	}, nil
 }
 
+// NewHelmClientFromRestConfig creates a helm client from a rest config, e.g. one with a custom
+// dialer or proxy to reach a private API endpoint.
+func NewHelmClientFromRestConfig(conf *rest.Config, namespace string) (*HelmClient, error) {
+	helmOption := helm.Options{
+		Debug:     true,
+		Linting:   true,
+		Namespace: namespace,
+	}
+
+	helmClient, err := helm.NewClientFromRestConf(&helm.RestConfClientOptions{
+		Options:    &helmOption,
+		RestConfig: conf,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	settings := cli.New()
+	actionConfig := new(action.Configuration)
+	if err := actionConfig.Init(&SimpleRESTClientGetter{
+		Namespace:  namespace,
+		RestConfig: conf,
+	}, namespace, os.Getenv("HELM_DRIVER"), func(format string, v ...interface{}) {}); err != nil {
+		return nil, err
+	}
+
+	return &HelmClient{
+		HelmOptions:  helmOption,
+		Client:       helmClient,
+		Timeout:      60 * time.Second,
+		ActionConfig: actionConfig,
+		EnvSettings:  settings,
+	}, nil
+}
+
 func (c *HelmClient) AddRepo(entry repo.Entry) error {
 	return c.Client.AddOrUpdateChartRepo(entry)
 }
@@ -337,6 +372,8 @@ func setHelmValue(vals map[string]interface{}, v string) (map[string]interface{}
 type SimpleRESTClientGetter struct {
 	Namespace  string
 	KubeConfig string
+	// RestConfig takes precedence over KubeConfig.
+	RestConfig *rest.Config
 }
 
 func NewRESTClientGetter(namespace, kubeConfig string) *SimpleRESTClientGetter {
@@ -347,6 +384,9 @@ func NewRESTClientGetter(namespace, kubeConfig string) *SimpleRESTClientGetter {
 }
 
 func (c *SimpleRESTClientGetter) ToRESTConfig() (*rest.Config, error) {
+	if c.RestConfig != nil {
+		return rest.CopyConfig(c.RestConfig), nil
+	}
 	config, err := clientcmd.RESTConfigFromKubeConfig([]byte(c.KubeConfig))
 	if err != nil {
 		return nil, err
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/cmd/clusterctl/client"
+	"sigs.k8s.io/cluster-api/cmd/clusterctl/client/cluster"
+)
+
+type MoveClusterOptions struct {
+	// ToKubeconfigFile or ToKubeconfigBytes and ToKubeconfigContext select the target management
+	// cluster, the current context is used when ToKubeconfigContext is empty.
+	ToKubeconfigFile    string
+	ToKubeconfigBytes   []byte
+	ToKubeconfigContext string
+	// Namespace of the Cluster objects to move, defaults to "default". Every cluster in
+	// the namespace is moved.
+	Namespace string
+	// ToDirectory saves the objects as YAML files instead of moving them, FromDirectory
+	// restores a saved directory into the target management cluster, or into this one when
+	// there is no target.
+	ToDirectory   string
+	FromDirectory string
+	DryRun        bool
+	// SkipTargetCheck skips verifying that the target has every provider of this management
+	// cluster installed and available.
+	SkipTargetCheck bool
+}
+
+type PivotOptions struct {
+	// Namespace of the Cluster objects to move, defaults to the namespace of the cluster.
+	Namespace string
+	// InitProviders installs the providers of this management cluster that are missing
+	// in the workload cluster before moving.
+	InitProviders bool
+	DryRun        bool
+	// Timeout bounds the wait for the providers of the workload cluster, defaults to 10 minutes.
+	Timeout time.Duration
+	// PollInterval defaults to 10 seconds.
+	PollInterval time.Duration
+}
+
+// MoveCluster wraps clusterctl move from this management cluster to another one or to and
+// from a backup directory.
+func (c *ClusterApiClient) MoveCluster(ctx context.Context, opt MoveClusterOptions) error {
+	if opt.Namespace == "" {
+		opt.Namespace = "default"
+	}
+
+	moveOptions := client.MoveOptions{
+		FromKubeconfig: c.clusterctlKubeconfig(),
+		Namespace:      opt.Namespace,
+		ToDirectory:    opt.ToDirectory,
+		FromDirectory:  opt.FromDirectory,
+		DryRun:         opt.DryRun,
+	}
+
+	var target *ClusterApiClient
+	if opt.ToKubeconfigFile != "" || opt.ToKubeconfigBytes != nil {
+		var err error
+		target, err = newMoveTargetClient(opt.ToKubeconfigFile, opt.ToKubeconfigBytes, opt.ToKubeconfigContext, c.ConfigFile)
+		if err != nil {
+			return err
+		}
+		moveOptions.ToKubeconfig = client.Kubeconfig{Path: moveTargetKubeconfigPath, Context: opt.ToKubeconfigContext}
+	} else if opt.FromDirectory != "" {
+		// clusterctl would restore into the cluster of $KUBECONFIG
+		moveOptions.ToKubeconfig = c.clusterctlKubeconfig()
+	}
+
+	if !opt.DryRun && !opt.SkipTargetCheck && opt.ToDirectory == "" && target != nil {
+		// a restore has no source providers to compare with
+		if err := c.checkMoveTarget(ctx, target, opt.FromDirectory == ""); err != nil {
+			return err
+		}
+	}
+
+	cl := c.Client
+	if target != nil {
+		proxy, err := target.clusterctlProxy(opt.ToKubeconfigContext)
+		if err != nil {
+			return err
+		}
+		cl, err = c.newClusterctlClient(ctx, nil, map[string]cluster.Proxy{moveTargetKubeconfigPath: proxy})
+		if err != nil {
+			return err
+		}
+	}
+
+	return cl.Move(ctx, moveOptions)
+}
+
+// moveTargetKubeconfigPath is the kubeconfig path given to clusterctl move for the target
+// cluster, it's resolved to the proxy of the target client.
+const moveTargetKubeconfigPath = "in-memory://move-target"
+
+// Pivot moves the Cluster API objects of a namespace into the workload cluster itself so
+// that it becomes its own management cluster, e.g. after bootstrapping from a kind cluster.
+func (c *ClusterApiClient) Pivot(ctx context.Context, clusterName, namespace string, opt PivotOptions) error {
+	if opt.Namespace == "" {
+		opt.Namespace = namespace
+	}
+	if opt.Timeout == 0 {
+		opt.Timeout = 10 * time.Minute
+	}
+	if opt.PollInterval == 0 {
+		opt.PollInterval = 10 * time.Second
+	}
+
+	kubeconfig, err := c.GetWorkloadClusterKubeconfigWithContext(ctx, clusterName, namespace)
+	if err != nil {
+		return err
+	}
+	kubeconfigBytes := []byte(*kubeconfig)
+
+	target, err := newMoveTargetClient("", kubeconfigBytes, "", c.ConfigFile)
+	if err != nil {
+		return err
+	}
+
+	if opt.InitProviders && !opt.DryRun {
+		if err := c.initMissingProviders(ctx, target, opt.Timeout); err != nil {
+			return err
+		}
+	}
+
+	if !opt.DryRun {
+		var notReady error
+		err = wait.PollUntilContextTimeout(ctx, opt.PollInterval, opt.Timeout, true, func(ctx context.Context) (bool, error) {
+			err := c.checkMoveTarget(ctx, target, true)
+			if errors.Is(err, ErrMoveTargetNotReady) {
+				notReady = err
+				return false, nil
+			}
+			return err == nil, err
+		})
+		if err != nil {
+			if wait.Interrupted(err) && notReady != nil {
+				return fmt.Errorf("%w: %w", notReady, err)
+			}
+			return err
+		}
+	}
+
+	return c.MoveCluster(ctx, MoveClusterOptions{
+		ToKubeconfigBytes: kubeconfigBytes,
+		Namespace:         opt.Namespace,
+		DryRun:            opt.DryRun,
+		SkipTargetCheck:   true,
+	})
+}
+
+func newMoveTargetClient(kubeconfigFile string, kubeconfigBytes []byte, kubeconfigContext, configFile string) (*ClusterApiClient, error) {
+	opts := []ClusterApiClientOption{WithKubeconfigContext(kubeconfigContext), WithClusterctlConfigFile(configFile)}
+	if kubeconfigBytes != nil {
+		opts = append(opts, WithKubeconfigBytes(kubeconfigBytes))
+	} else {
+		opts = append(opts, WithKubeconfigFile(kubeconfigFile))
+	}
+
+	return NewClusterApiClientWithOptions(opts...)
+}
+
+// checkMoveTarget returns ErrMoveTargetNotReady listing every provider that is missing or
+// not available on the target.
+func (c *ClusterApiClient) checkMoveTarget(ctx context.Context, target *ClusterApiClient, compareSource bool) error {
+	targetProviders, err := target.listInventoryProviders(ctx)
+	if err != nil {
+		return err
+	}
+
+	problems := []string{}
+	if len(targetProviders.FilterCore()) == 0 {
+		problems = append(problems, "cluster-api core provider is not installed")
+	}
+	if compareSource {
+		missing, err := c.missingProviders(ctx, targetProviders)
+		if err != nil {
+			return err
+		}
+		for _, provider := range missing {
+			problems = append(problems, fmt.Sprintf("provider %s is not installed", provider.InstanceName()))
+		}
+	}
+	for _, provider := range targetProviders.Items {
+		available, message, err := target.providerAvailability(ctx, provider)
+		if err != nil {
+			return err
+		}
+		if !available {
+			problems = append(problems, fmt.Sprintf("provider %s is not available: %s", provider.InstanceName(), message))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrMoveTargetNotReady, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// missingProviders returns the providers of this management cluster that aren't in the target inventory.
+func (c *ClusterApiClient) missingProviders(ctx context.Context, targetProviders *clusterctlv1.ProviderList) ([]clusterctlv1.Provider, error) {
+	sourceProviders, err := c.listInventoryProviders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := []clusterctlv1.Provider{}
+	for _, provider := range sourceProviders.Items {
+		if len(targetProviders.FilterByProviderNameAndType(provider.ProviderName, provider.GetProviderType())) == 0 {
+			missing = append(missing, provider)
+		}
+	}
+	return missing, nil
+}
+
+// initMissingProviders runs clusterctl init on the target with the same provider versions
+// as this management cluster.
+func (c *ClusterApiClient) initMissingProviders(ctx context.Context, target *ClusterApiClient, timeout time.Duration) error {
+	targetProviders, err := target.listInventoryProviders(ctx)
+	if err != nil {
+		return err
+	}
+	missing, err := c.missingProviders(ctx, targetProviders)
+	if err != nil {
+		return err
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	refs := providerRefs{}
+	for _, provider := range missing {
+		refs.add(provider.GetProviderType(), provider.ProviderName+":"+provider.Version)
+	}
+
+	_, err = target.Client.Init(ctx, client.InitOptions{
+		Kubeconfig:                target.clusterctlKubeconfig(),
+		CoreProvider:              refs.core,
+		BootstrapProviders:        refs.bootstrap,
+		ControlPlaneProviders:     refs.controlPlane,
+		InfrastructureProviders:   refs.infrastructure,
+		IPAMProviders:             refs.ipam,
+		RuntimeExtensionProviders: refs.runtimeExtension,
+		AddonProviders:            refs.addon,
+		WaitProviders:             true,
+		WaitProviderTimeout:       timeout,
+	})
+	return err
+}
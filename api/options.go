@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+
+	"k8s.io/client-go/rest"
+)
+
+type (
+	ClusterApiClientOption func(*clusterApiClientOptions)
+
+	// DialFunc dials the API server of a cluster, e.g. through a bastion or a tunnel.
+	DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+	// ProxyFunc returns the HTTP proxy for a request to the API server of a cluster.
+	ProxyFunc func(*http.Request) (*url.URL, error)
+
+	clusterApiClientOptions struct {
+		configFile        string
+		kubeconfigFile    string
+		kubeconfigBytes   []byte
+		kubeconfigContext string
+		restConfig        *rest.Config
+		inCluster         bool
+		burst             int
+		qps               float32
+		dial              DialFunc
+		proxy             ProxyFunc
+		workloadDial      DialFunc
+		workloadProxy     ProxyFunc
+	}
+)
+
+// WithClusterctlConfigFile sets the clusterctl config file, the default clusterctl
+// config location is used when empty.
+func WithClusterctlConfigFile(configFile string) ClusterApiClientOption {
+	return func(o *clusterApiClientOptions) {
+		o.configFile = configFile
+	}
+}
+
+func WithKubeconfigFile(kubeconfigFile string) ClusterApiClientOption {
+	return func(o *clusterApiClientOptions) {
+		o.kubeconfigFile = kubeconfigFile
+	}
+}
+
+func WithKubeconfigBytes(kubeconfig []byte) ClusterApiClientOption {
+	return func(o *clusterApiClientOptions) {
+		o.kubeconfigBytes = kubeconfig
+	}
+}
+
+// WithKubeconfigContext selects a context of the kubeconfig file or bytes, the current context
+// is used when empty.
+func WithKubeconfigContext(kubeconfigContext string) ClusterApiClientOption {
+	return func(o *clusterApiClientOptions) {
+		o.kubeconfigContext = kubeconfigContext
+	}
+}
+
+// WithRestConfig takes precedence over every other kubeconfig source.
+func WithRestConfig(conf *rest.Config) ClusterApiClientOption {
+	return func(o *clusterApiClientOptions) {
+		o.restConfig = conf
+	}
+}
+
+func WithInClusterConfig() ClusterApiClientOption {
+	return func(o *clusterApiClientOptions) {
+		o.inCluster = true
+	}
+}
+
+func WithRateLimit(burst int, qps float32) ClusterApiClientOption {
+	return func(o *clusterApiClientOptions) {
+		o.burst = burst
+		o.qps = qps
+	}
+}
+
+// WithWorkloadDialer sets the dialer of the clients returned by WorkloadClient, for workload
+// clusters whose API endpoint isn't reachable directly.
+func WithWorkloadDialer(dial DialFunc) ClusterApiClientOption {
+	return func(o *clusterApiClientOptions) {
+		o.workloadDial = dial
+	}
+}
+
+// WithWorkloadProxy sets the HTTP proxy of the clients returned by WorkloadClient.
+func WithWorkloadProxy(proxy ProxyFunc) ClusterApiClientOption {
+	return func(o *clusterApiClientOptions) {
+		o.workloadProxy = proxy
+	}
+}
+
+// withTransport sets the dialer and proxy of the client's own rest config.
+func withTransport(dial DialFunc, proxy ProxyFunc) ClusterApiClientOption {
+	return func(o *clusterApiClientOptions) {
+		o.dial = dial
+		o.proxy = proxy
+	}
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+)
+
+var crdResource = apiextensionsv1.SchemeGroupVersion.WithResource("customresourcedefinitions")
+
+// crdEstablishedTimeout bounds the wait for the custom resource definitions of a manifest.
+const crdEstablishedTimeout = 2 * time.Minute
+
+// manifestKindOrder is the apply order of a manifest: namespaces, custom resource definitions,
+// RBAC, configuration, every other kind, e.g. workloads and custom resources, then webhooks so
+// that they don't reject objects before their service is running.
+var manifestKindOrder = map[string]int{
+	"Namespace":                        0,
+	"CustomResourceDefinition":         1,
+	"ServiceAccount":                   2,
+	"ClusterRole":                      2,
+	"Role":                             2,
+	"ClusterRoleBinding":               2,
+	"RoleBinding":                      2,
+	"ConfigMap":                        3,
+	"Secret":                           3,
+	"MutatingWebhookConfiguration":     5,
+	"ValidatingWebhookConfiguration":   5,
+	"ValidatingAdmissionPolicy":        5,
+	"ValidatingAdmissionPolicyBinding": 5,
+}
+
+const (
+	crdKindOrder     = 1
+	defaultKindOrder = 4
+)
+
+func manifestObjectOrder(rawObj runtime.RawExtension) int {
+	typeMeta := metav1.TypeMeta{}
+	if err := json.Unmarshal(rawObj.Raw, &typeMeta); err != nil {
+		return defaultKindOrder
+	}
+	if order, ok := manifestKindOrder[typeMeta.Kind]; ok {
+		return order
+	}
+	return defaultKindOrder
+}
+
+// orderManifestObjects sorts the objects by manifestKindOrder, objects of the same order keep
+// their order in the manifest.
+func orderManifestObjects(rawObjs []runtime.RawExtension) []runtime.RawExtension {
+	ordered := make([]runtime.RawExtension, len(rawObjs))
+	copy(ordered, rawObjs)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return manifestObjectOrder(ordered[i]) < manifestObjectOrder(ordered[j])
+	})
+	return ordered
+}
+
+// applyInOrder calls apply for every object in manifestKindOrder. Once the custom resource
+// definitions are applied, they are waited for until established and the REST mapper is
+// reset so that the custom resources after them can be mapped.
+func (c *ClusterApiClient) applyInOrder(ctx context.Context, rawObjs []runtime.RawExtension, action string, apply func(dynamic.ResourceInterface, *unstructured.Unstructured) error) error {
+	crds := []string{}
+	for _, rawObj := range orderManifestObjects(rawObjs) {
+		if len(crds) > 0 && manifestObjectOrder(rawObj) > crdKindOrder {
+			if err := c.waitForCRDsEstablished(ctx, crds); err != nil {
+				return err
+			}
+			crds = nil
+		}
+
+		dri, unstructuredObj, err := c.createDynamicResourceInterface(ctx, rawObj, action)
+		if err != nil {
+			return err
+		}
+		if dri == nil {
+			continue
+		}
+
+		if err := apply(*dri, unstructuredObj); err != nil {
+			return err
+		}
+		if unstructuredObj.GroupVersionKind().GroupKind() == apiextensionsv1.Kind("CustomResourceDefinition") {
+			crds = append(crds, unstructuredObj.GetName())
+		}
+	}
+
+	// the custom resources may follow in another manifest
+	if len(crds) > 0 {
+		return c.waitForCRDsEstablished(ctx, crds)
+	}
+	return nil
+}
+
+// waitForCRDsEstablished waits until the custom resource definitions are established, then
+// resets the REST mapper.
+func (c *ClusterApiClient) waitForCRDsEstablished(ctx context.Context, names []string) error {
+	pending := names
+	err := wait.PollUntilContextTimeout(ctx, time.Second, crdEstablishedTimeout, true, func(ctx context.Context) (bool, error) {
+		notEstablished := []string{}
+		for _, name := range pending {
+			established, err := c.crdEstablished(ctx, name)
+			if err != nil {
+				return false, err
+			}
+			if !established {
+				notEstablished = append(notEstablished, name)
+			}
+		}
+		pending = notEstablished
+		return len(pending) == 0, nil
+	})
+	if err != nil {
+		if wait.Interrupted(err) {
+			return fmt.Errorf("%w: %s: %w", ErrCRDNotEstablished, strings.Join(pending, ", "), err)
+		}
+		return err
+	}
+
+	c.restMapper().Reset()
+	return nil
+}
+
+func (c *ClusterApiClient) crdEstablished(ctx context.Context, name string) (bool, error) {
+	obj, err := c.DynamicInterface.Resource(crdResource).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, crd); err != nil {
+		return false, err
+	}
+
+	for _, condition := range crd.Status.Conditions {
+		if condition.Type == apiextensionsv1.NamesAccepted && condition.Status == apiextensionsv1.ConditionFalse {
+			return false, fmt.Errorf("%w: %s: %s", ErrCRDNotEstablished, name, condition.Message)
+		}
+		if condition.Type == apiextensionsv1.Established {
+			return condition.Status == apiextensionsv1.ConditionTrue, nil
+		}
+	}
+	return false, nil
+}
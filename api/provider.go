@@ -0,0 +1,283 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/LyridInc/cluster-api-go-sdk/model"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/cmd/clusterctl/client"
+)
+
+var providerResource = clusterctlv1.GroupVersion.WithResource("providers")
+
+type ProviderUpgradeOptions struct {
+	// Contract upgrades every provider to the latest version of the contract, defaults to
+	// the contract of this clusterctl version. It's ignored when Providers is set.
+	Contract string
+	// Providers limits the upgrade to the given providers, each one is upgraded to its
+	// AvailableVersion, e.g. a provider returned by PlanUpgrade.
+	Providers     []model.Provider
+	WaitProviders bool
+	// WaitProviderTimeout defaults to 5 minutes.
+	WaitProviderTimeout time.Duration
+}
+
+// listInventoryProviders returns the providers recorded in the clusterctl inventory, an empty
+// list is returned when clusterctl has never initialized the cluster.
+func (c *ClusterApiClient) listInventoryProviders(ctx context.Context) (*clusterctlv1.ProviderList, error) {
+	list := &clusterctlv1.ProviderList{}
+	if err := c.listCapiObjects(ctx, providerResource, "", "", list); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return list, nil
+		}
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// providerAvailability checks the Available condition of the Deployments installed for a provider.
+func (c *ClusterApiClient) providerAvailability(ctx context.Context, provider clusterctlv1.Provider) (bool, string, error) {
+	return c.deploymentsAvailability(ctx, provider.Namespace, clusterv1.ProviderNameLabel+"="+provider.ManifestLabel())
+}
+
+func (c *ClusterApiClient) deploymentsAvailability(ctx context.Context, namespace, labelSelector string) (bool, string, error) {
+	deployments, err := c.Clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labelSelector,
+	})
+	if err != nil {
+		return false, "", err
+	}
+	if len(deployments.Items) == 0 {
+		return false, fmt.Sprintf("no deployments found in namespace %s", namespace), nil
+	}
+
+	for _, deployment := range deployments.Items {
+		if !deploymentAvailable(deployment) {
+			return false, fmt.Sprintf("deployment %s/%s is not available", deployment.Namespace, deployment.Name), nil
+		}
+	}
+
+	return true, "", nil
+}
+
+func deploymentAvailable(deployment appsv1.Deployment) bool {
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentAvailable {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// WaitForProviders waits until the Deployments of the given providers are available and returns
+// the status of each one. Providers are matched by name, e.g. "openstack", or by their type
+// prefixed name, e.g. "bootstrap-kubeadm", and every installed provider is waited for when
+// none is given. The wait is bounded by the deadline of ctx.
+func (c *ClusterApiClient) WaitForProviders(ctx context.Context, providers ...string) ([]model.ProviderStatus, error) {
+	var statuses []model.ProviderStatus
+	err := wait.PollUntilContextCancel(ctx, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		var err error
+		statuses, err = c.providerStatuses(ctx, providers)
+		if err != nil {
+			return false, err
+		}
+
+		for _, status := range statuses {
+			if !status.Available {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		if wait.Interrupted(err) {
+			notAvailable := []string{}
+			for _, status := range statuses {
+				if !status.Available {
+					notAvailable = append(notAvailable, status.Name+": "+status.Message)
+				}
+			}
+			return statuses, fmt.Errorf("%w: %s: %w", ErrProviderNotAvailable, strings.Join(notAvailable, "; "), err)
+		}
+		return statuses, err
+	}
+
+	return statuses, nil
+}
+
+func (c *ClusterApiClient) providerStatuses(ctx context.Context, names []string) ([]model.ProviderStatus, error) {
+	inventory, err := c.listInventoryProviders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []model.ProviderStatus{}
+	selected := inventory.Items
+	if len(names) > 0 {
+		selected = []clusterctlv1.Provider{}
+		for _, name := range names {
+			matched := false
+			for _, provider := range inventory.Items {
+				if provider.ProviderName == name || provider.ManifestLabel() == name {
+					selected = append(selected, provider)
+					matched = true
+				}
+			}
+			if !matched {
+				statuses = append(statuses, model.ProviderStatus{
+					Provider: model.Provider{Name: name},
+					Message:  "provider is not installed",
+				})
+			}
+		}
+	}
+
+	for _, provider := range selected {
+		available, message, err := c.providerAvailability(ctx, provider)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, model.ProviderStatus{
+			Provider:  newProvider(provider, ""),
+			Available: available,
+			Message:   message,
+		})
+	}
+
+	return statuses, nil
+}
+
+// ListInstalledProviders returns the providers from the clusterctl inventory of the management cluster.
+func (c *ClusterApiClient) ListInstalledProviders(ctx context.Context) ([]model.Provider, error) {
+	inventory, err := c.listInventoryProviders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	providers := []model.Provider{}
+	for _, provider := range inventory.Items {
+		providers = append(providers, newProvider(provider, ""))
+	}
+	return providers, nil
+}
+
+// PlanUpgrade returns an upgrade plan per Cluster API contract with the latest version
+// available for each installed provider.
+func (c *ClusterApiClient) PlanUpgrade(ctx context.Context) ([]model.ProviderUpgradePlan, error) {
+	upgradePlans, err := c.Client.PlanUpgrade(ctx, client.PlanUpgradeOptions{
+		Kubeconfig: c.clusterctlKubeconfig(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	plans := []model.ProviderUpgradePlan{}
+	for _, upgradePlan := range upgradePlans {
+		plan := model.ProviderUpgradePlan{
+			Contract:  upgradePlan.Contract,
+			Providers: []model.Provider{},
+		}
+		for _, item := range upgradePlan.Providers {
+			plan.Providers = append(plan.Providers, newProvider(item.Provider, item.NextVersion))
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+// ApplyUpgrade upgrades the providers to the AvailableVersion of opt.Providers, or every
+// provider to the latest version of opt.Contract when no provider is given.
+func (c *ClusterApiClient) ApplyUpgrade(ctx context.Context, opt ProviderUpgradeOptions) error {
+	refs := providerRefs{}
+	for _, provider := range opt.Providers {
+		// PlanUpgrade leaves AvailableVersion empty for providers that are up to date
+		if provider.AvailableVersion == "" {
+			continue
+		}
+		refs.add(clusterctlv1.ProviderType(provider.Type), provider.Namespace+"/"+provider.Name+":"+provider.AvailableVersion)
+	}
+	if len(opt.Providers) > 0 && refs.empty() {
+		return nil
+	}
+
+	// clusterctl upgrades either a contract or the given providers
+	contract := ""
+	if refs.empty() {
+		contract = opt.Contract
+		if contract == "" {
+			contract = clusterv1.GroupVersion.Version
+		}
+	}
+
+	return c.Client.ApplyUpgrade(ctx, client.ApplyUpgradeOptions{
+		Kubeconfig:                c.clusterctlKubeconfig(),
+		Contract:                  contract,
+		CoreProvider:              refs.core,
+		BootstrapProviders:        refs.bootstrap,
+		ControlPlaneProviders:     refs.controlPlane,
+		InfrastructureProviders:   refs.infrastructure,
+		IPAMProviders:             refs.ipam,
+		RuntimeExtensionProviders: refs.runtimeExtension,
+		AddonProviders:            refs.addon,
+		WaitProviders:             opt.WaitProviders,
+		WaitProviderTimeout:       opt.WaitProviderTimeout,
+	})
+}
+
+func newProvider(provider clusterctlv1.Provider, availableVersion string) model.Provider {
+	return model.Provider{
+		Name:             provider.ProviderName,
+		Type:             provider.Type,
+		Namespace:        provider.Namespace,
+		CurrentVersion:   provider.Version,
+		AvailableVersion: availableVersion,
+		WatchedNamespace: provider.WatchedNamespace,
+	}
+}
+
+// providerRefs groups provider references, e.g. "openstack:v0.12.4", by provider type
+// the way clusterctl init and upgrade options take them.
+type providerRefs struct {
+	core             string
+	bootstrap        []string
+	controlPlane     []string
+	infrastructure   []string
+	ipam             []string
+	runtimeExtension []string
+	addon            []string
+}
+
+func (r *providerRefs) empty() bool {
+	return r.core == "" && len(r.bootstrap) == 0 && len(r.controlPlane) == 0 && len(r.infrastructure) == 0 &&
+		len(r.ipam) == 0 && len(r.runtimeExtension) == 0 && len(r.addon) == 0
+}
+
+func (r *providerRefs) add(providerType clusterctlv1.ProviderType, ref string) {
+	switch providerType {
+	case clusterctlv1.CoreProviderType:
+		r.core = ref
+	case clusterctlv1.BootstrapProviderType:
+		r.bootstrap = append(r.bootstrap, ref)
+	case clusterctlv1.ControlPlaneProviderType:
+		r.controlPlane = append(r.controlPlane, ref)
+	case clusterctlv1.InfrastructureProviderType:
+		r.infrastructure = append(r.infrastructure, ref)
+	case clusterctlv1.IPAMProviderType:
+		r.ipam = append(r.ipam, ref)
+	case clusterctlv1.RuntimeExtensionProviderType:
+		r.runtimeExtension = append(r.runtimeExtension, ref)
+	case clusterctlv1.AddonProviderType:
+		r.addon = append(r.addon, ref)
+	}
+}
@@ -0,0 +1,363 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/cmd/clusterctl/client"
+	"sigs.k8s.io/cluster-api/cmd/clusterctl/client/cluster"
+	"sigs.k8s.io/cluster-api/cmd/clusterctl/client/config"
+	controlplanev1 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1beta1"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1beta1"
+	expv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	"sigs.k8s.io/cluster-api/version"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// inMemoryKubeconfigPath is the kubeconfig path given to clusterctl for the cluster of a
+// ClusterApiClient, the cluster client factory replaces the file based proxy of clusterctl
+// with a proxy built from the kubeconfig bytes or the rest config of the client.
+const inMemoryKubeconfigPath = "in-memory://management-cluster"
+
+// clusterctlScheme has the same types as the scheme clusterctl uses internally.
+var clusterctlScheme = runtime.NewScheme()
+
+func init() {
+	_ = clientgoscheme.AddToScheme(clusterctlScheme)
+	_ = clusterctlv1.AddToScheme(clusterctlScheme)
+	_ = clusterv1.AddToScheme(clusterctlScheme)
+	_ = apiextensionsv1.AddToScheme(clusterctlScheme)
+	_ = admissionregistrationv1.AddToScheme(clusterctlScheme)
+	_ = addonsv1.AddToScheme(clusterctlScheme)
+	_ = controlplanev1.AddToScheme(clusterctlScheme)
+	_ = expv1.AddToScheme(clusterctlScheme)
+}
+
+// clusterctlKubeconfig returns the kubeconfig to pass in clusterctl options for this client.
+func (c *ClusterApiClient) clusterctlKubeconfig() client.Kubeconfig {
+	return client.Kubeconfig{Path: inMemoryKubeconfigPath, Context: c.KubeconfigContext}
+}
+
+// newClusterctlClient returns a clusterctl client whose cluster client factory resolves
+// inMemoryKubeconfigPath to this client and the paths of proxies to their proxy. Other paths
+// are loaded from disk by clusterctl.
+func (c *ClusterApiClient) newClusterctlClient(ctx context.Context, configClient config.Client, proxies map[string]cluster.Proxy) (client.Client, error) {
+	if configClient == nil {
+		var err error
+		configClient, err = config.New(ctx, c.ConfigFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrClusterctlConfig, err)
+		}
+	}
+
+	factory := func(input client.ClusterClientFactoryInput) (cluster.Client, error) {
+		options := []cluster.Option{cluster.InjectYamlProcessor(input.Processor)}
+		if input.Kubeconfig.Path == inMemoryKubeconfigPath {
+			proxy, err := c.clusterctlProxy(input.Kubeconfig.Context)
+			if err != nil {
+				return nil, err
+			}
+			options = append(options, cluster.InjectProxy(proxy))
+		} else if proxy, ok := proxies[input.Kubeconfig.Path]; ok {
+			options = append(options, cluster.InjectProxy(proxy))
+		}
+		return cluster.New(cluster.Kubeconfig(input.Kubeconfig), configClient, options...), nil
+	}
+
+	return client.New(ctx, c.ConfigFile, client.InjectConfig(configClient), client.InjectClusterClientFactory(factory))
+}
+
+// clusterctlProxy is built when clusterctl needs the cluster, so kubeconfig bytes set after
+// the client was created are used.
+func (c *ClusterApiClient) clusterctlProxy(kubeconfigContext string) (cluster.Proxy, error) {
+	if c.ConfigBytes != nil {
+		p, err := newKubeconfigProxy(c.ConfigBytes, kubeconfigContext)
+		if err != nil {
+			return nil, err
+		}
+		// keep the dialer and proxy of clients that reach private API endpoints
+		if c.Config != nil {
+			p.dial = c.Config.Dial
+			p.proxy = c.Config.Proxy
+		}
+		return p, nil
+	}
+	if c.Config == nil {
+		return nil, fmt.Errorf("%w: the client has neither kubeconfig bytes nor a rest config", ErrInvalidKubeconfig)
+	}
+	return &kubeconfigProxy{restConfig: rest.CopyConfig(c.Config), timeout: 30 * time.Second}, nil
+}
+
+// kubeconfigProxy implements the clusterctl cluster proxy from an in-memory kubeconfig, or
+// from a rest config for clients without a kubeconfig, e.g. in-cluster clients.
+type kubeconfigProxy struct {
+	kubeconfig *clientcmdapi.Config
+	context    string
+	restConfig *rest.Config
+	timeout    time.Duration
+	dial       func(ctx context.Context, network, address string) (net.Conn, error)
+	proxy      func(*http.Request) (*url.URL, error)
+}
+
+var _ cluster.Proxy = &kubeconfigProxy{}
+
+func newKubeconfigProxy(kubeconfigBytes []byte, kubeconfigContext string) (*kubeconfigProxy, error) {
+	kubeconfig, err := clientcmd.Load(kubeconfigBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKubeconfig, err)
+	}
+	if kubeconfigContext != "" {
+		if _, ok := kubeconfig.Contexts[kubeconfigContext]; !ok {
+			return nil, fmt.Errorf("%w: context %s not found", ErrInvalidKubeconfig, kubeconfigContext)
+		}
+	}
+
+	return &kubeconfigProxy{kubeconfig: kubeconfig, context: kubeconfigContext, timeout: 30 * time.Second}, nil
+}
+
+func (p *kubeconfigProxy) GetConfig() (*rest.Config, error) {
+	var conf *rest.Config
+	if p.kubeconfig != nil {
+		var err error
+		conf, err = clientcmd.NewDefaultClientConfig(*p.kubeconfig, &clientcmd.ConfigOverrides{
+			CurrentContext: p.context,
+			Timeout:        p.timeout.String(),
+		}).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidKubeconfig, err)
+		}
+		conf.Dial = p.dial
+		conf.Proxy = p.proxy
+	} else {
+		conf = rest.CopyConfig(p.restConfig)
+		conf.Timeout = p.timeout
+	}
+	conf.UserAgent = fmt.Sprintf("clusterctl/%s (%s)", version.Get().GitVersion, version.Get().Platform)
+	// same rate limit as clusterctl to avoid client side throttling
+	conf.QPS = 20
+	conf.Burst = 100
+
+	return conf, nil
+}
+
+func (p *kubeconfigProxy) CurrentNamespace() (string, error) {
+	if p.kubeconfig == nil {
+		return metav1.NamespaceDefault, nil
+	}
+
+	kubeconfigContext := p.kubeconfig.CurrentContext
+	if p.context != "" {
+		kubeconfigContext = p.context
+	}
+	kubeContext, ok := p.kubeconfig.Contexts[kubeconfigContext]
+	if !ok {
+		return "", fmt.Errorf("%w: context %s not found", ErrInvalidKubeconfig, kubeconfigContext)
+	}
+	if kubeContext.Namespace != "" {
+		return kubeContext.Namespace, nil
+	}
+	return metav1.NamespaceDefault, nil
+}
+
+func (p *kubeconfigProxy) ValidateKubernetesVersion() error {
+	conf, err := p.GetConfig()
+	if err != nil {
+		return err
+	}
+
+	minVersion := version.MinimumKubernetesVersion
+	if clusterTopology, _ := strconv.ParseBool(os.Getenv("CLUSTER_TOPOLOGY")); clusterTopology {
+		minVersion = version.MinimumKubernetesVersionClusterTopology
+	}
+	return version.CheckKubernetesVersion(conf, minVersion)
+}
+
+func (p *kubeconfigProxy) NewClient(ctx context.Context) (ctrlclient.Client, error) {
+	conf, err := p.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var cl ctrlclient.Client
+	err = retryWithBackoff(ctx, func() error {
+		cl, err = ctrlclient.New(conf, ctrlclient.Options{Scheme: clusterctlScheme})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the management cluster: %w", err)
+	}
+	return cl, nil
+}
+
+func (p *kubeconfigProxy) CheckClusterAvailable(ctx context.Context) error {
+	conf, err := p.GetConfig()
+	if err != nil {
+		return err
+	}
+
+	return retryWithBackoff(ctx, func() error {
+		_, err := ctrlclient.New(conf, ctrlclient.Options{Scheme: clusterctlScheme})
+		return err
+	})
+}
+
+// ListResources follows the clusterctl proxy: objects of the CRDs of the listed component are
+// excluded so that providers that are already removed don't break the listing.
+func (p *kubeconfigProxy) ListResources(ctx context.Context, labels map[string]string, namespaces ...string) ([]unstructured.Unstructured, error) {
+	conf, err := p.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(conf)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKubernetesClient, err)
+	}
+	cl, err := p.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var resourceLists []*metav1.APIResourceList
+	if err := retryWithBackoff(ctx, func() error {
+		resourceLists, err = clientset.Discovery().ServerPreferredResources()
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list api resources: %w", err)
+	}
+
+	crds := &apiextensionsv1.CustomResourceDefinitionList{}
+	if err := retryWithBackoff(ctx, func() error {
+		return cl.List(ctx, crds)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list CRDs: %w", err)
+	}
+	excluded := sets.Set[string]{}
+	for _, crd := range crds.Items {
+		component, isCoreComponent := labels[clusterctlv1.ClusterctlCoreLabel]
+		_, isProviderResource := crd.Labels[clusterv1.ProviderNameLabel]
+		if (isCoreComponent && component == clusterctlv1.ClusterctlCoreLabelCertManagerValue) || isProviderResource {
+			for _, crdVersion := range crd.Spec.Versions {
+				excluded.Insert(schema.GroupVersionKind{Group: crd.Spec.Group, Version: crdVersion.Name, Kind: crd.Spec.Names.Kind}.String())
+			}
+		}
+	}
+
+	resourceLists = discovery.FilteredBy(discovery.SupportsAllVerbs{Verbs: []string{"list", "delete"}}, resourceLists)
+
+	objs := []unstructured.Unstructured{}
+	for _, resourceList := range resourceLists {
+		gv, err := schema.ParseGroupVersion(resourceList.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, resource := range resourceList.APIResources {
+			// extensions/v1beta1 only duplicates kinds of apps and networking.k8s.io
+			if resourceList.GroupVersion == "extensions/v1beta1" {
+				continue
+			}
+			if excluded.Has(gv.WithKind(resource.Kind).String()) {
+				continue
+			}
+
+			listOptions := [][]ctrlclient.ListOption{{ctrlclient.MatchingLabels(labels)}}
+			if resource.Namespaced {
+				listOptions = [][]ctrlclient.ListOption{}
+				for _, namespace := range namespaces {
+					listOptions = append(listOptions, []ctrlclient.ListOption{ctrlclient.MatchingLabels(labels), ctrlclient.InNamespace(namespace)})
+				}
+			}
+			for _, options := range listOptions {
+				list, err := listUnstructured(ctx, cl, resourceList.GroupVersion, resource.Kind, options)
+				if err != nil {
+					return nil, err
+				}
+				objs = append(objs, list.Items...)
+			}
+		}
+	}
+
+	return objs, nil
+}
+
+func (p *kubeconfigProxy) GetContexts(prefix string) ([]string, error) {
+	contexts := []string{}
+	if p.kubeconfig == nil {
+		return contexts, nil
+	}
+	for name := range p.kubeconfig.Contexts {
+		if strings.HasPrefix(name, prefix) {
+			contexts = append(contexts, name)
+		}
+	}
+	return contexts, nil
+}
+
+func (p *kubeconfigProxy) GetResourceNames(ctx context.Context, groupVersion, kind string, options []ctrlclient.ListOption, prefix string) ([]string, error) {
+	cl, err := p.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list, err := listUnstructured(ctx, cl, groupVersion, kind, options)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, item := range list.Items {
+		if strings.HasPrefix(item.GetName(), prefix) {
+			names = append(names, item.GetName())
+		}
+	}
+	return names, nil
+}
+
+func listUnstructured(ctx context.Context, cl ctrlclient.Client, groupVersion, kind string, options []ctrlclient.ListOption) (*unstructured.UnstructuredList, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetAPIVersion(groupVersion)
+	list.SetKind(kind)
+
+	if err := retryWithBackoff(ctx, func() error {
+		return cl.List(ctx, list, options...)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", list.GroupVersionKind(), err)
+	}
+	return list, nil
+}
+
+// retryWithBackoff retries for about 15 seconds like the clusterctl proxy does.
+func retryWithBackoff(ctx context.Context, operation func() error) error {
+	backoff := wait.Backoff{Duration: 250 * time.Millisecond, Factor: 1.5, Steps: 9, Jitter: 0.1}
+
+	var lastErr error
+	err := wait.ExponentialBackoffWithContext(ctx, backoff, func(ctx context.Context) (bool, error) {
+		lastErr = operation()
+		return lastErr == nil, nil
+	})
+	if err != nil && lastErr != nil {
+		return lastErr
+	}
+	return err
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+type ScaleOptions struct {
+	// Wait blocks until the expected number of machines are Running and their nodes are healthy.
+	Wait bool
+	// Timeout defaults to 30 minutes.
+	Timeout time.Duration
+	// PollInterval defaults to 10 seconds.
+	PollInterval time.Duration
+}
+
+func (c *ClusterApiClient) ScaleMachineDeployment(ctx context.Context, name, namespace string, replicas int32, opt ScaleOptions) error {
+	if replicas < 0 {
+		return fmt.Errorf("%w: machine deployment replicas must not be negative, got %d", ErrInvalidReplicas, replicas)
+	}
+
+	if err := c.scaleCapiObject(ctx, machineDeploymentResource, name, namespace, replicas); err != nil {
+		return err
+	}
+
+	if !opt.Wait {
+		return nil
+	}
+	return c.waitForMachines(ctx, namespace, clusterv1.MachineDeploymentNameLabel+"="+name, replicas, opt)
+}
+
+// ScaleControlPlane scales a KubeadmControlPlane, only odd replica counts are
+// accepted to keep etcd quorum.
+func (c *ClusterApiClient) ScaleControlPlane(ctx context.Context, name, namespace string, replicas int32, opt ScaleOptions) error {
+	if replicas < 1 || replicas%2 == 0 {
+		return fmt.Errorf("%w: control plane replicas must be an odd number, got %d", ErrInvalidReplicas, replicas)
+	}
+
+	if err := c.scaleCapiObject(ctx, kubeadmControlPlaneResource, name, namespace, replicas); err != nil {
+		return err
+	}
+
+	if !opt.Wait {
+		return nil
+	}
+	return c.waitForMachines(ctx, namespace, clusterv1.MachineControlPlaneNameLabel+"="+name, replicas, opt)
+}
+
+func (c *ClusterApiClient) scaleCapiObject(ctx context.Context, resource schema.GroupVersionResource, name, namespace string, replicas int32) error {
+	patch := []byte(fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas))
+	_, err := c.DynamicInterface.Resource(resource).
+		Namespace(namespace).
+		Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}, "scale")
+
+	return err
+}
+
+// waitForMachines waits until exactly the expected number of machines matching the selector
+// exist, are Running and report a healthy node.
+func (c *ClusterApiClient) waitForMachines(ctx context.Context, namespace, labelSelector string, replicas int32, opt ScaleOptions) error {
+	timeout := opt.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Minute
+	}
+	interval := opt.PollInterval
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+
+	var notReady *ClusterNotReadyError
+	err := wait.PollUntilContextTimeout(ctx, interval, timeout, true, func(ctx context.Context) (bool, error) {
+		machines, err := c.ListMachines(ctx, namespace, labelSelector)
+		if err != nil {
+			return false, err
+		}
+
+		notReady = nil
+		count := int32(0)
+		for _, machine := range machines.Items {
+			if machine.DeletionTimestamp != nil {
+				continue
+			}
+			count++
+
+			status := newClusterObjectStatus("Machine", machine.ObjectMeta, machine.Status.Conditions)
+			nodeHealthy := false
+			for _, condition := range machine.Status.Conditions {
+				if condition.Type == clusterv1.MachineNodeHealthyCondition && condition.Status == v1.ConditionTrue {
+					nodeHealthy = true
+				}
+			}
+			running := machine.Status.GetTypedPhase() == clusterv1.MachinePhaseRunning
+			if notReady == nil && (!running || !nodeHealthy || machine.Status.NodeRef == nil) {
+				message := status.Message
+				if message == "" {
+					message = "machine is in phase " + machine.Status.Phase
+				}
+				notReady = &ClusterNotReadyError{
+					Kind:          "Machine",
+					Name:          machine.Name,
+					Namespace:     machine.Namespace,
+					ConditionType: status.ConditionType,
+					Reason:        status.Reason,
+					Message:       message,
+				}
+			}
+		}
+
+		if notReady == nil && count != replicas {
+			notReady = &ClusterNotReadyError{
+				Kind:      "Machine",
+				Name:      labelSelector,
+				Namespace: namespace,
+				Message:   fmt.Sprintf("%d of %d machines exist", count, replicas),
+			}
+		}
+
+		return notReady == nil, nil
+	})
+	if err != nil {
+		if wait.Interrupted(err) && notReady != nil {
+			notReady.Err = err
+			return notReady
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,364 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/LyridInc/cluster-api-go-sdk/option"
+	"gopkg.in/yaml.v2"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// GenerateTopologyCluster returns the YAML of a Cluster with a managed topology based on a
+// ClusterClass of the management cluster. The machine deployment classes and the variables
+// are validated against the ClusterClass before the YAML is returned.
+func (c *ClusterApiClient) GenerateTopologyCluster(ctx context.Context, opt option.GenerateTopologyClusterOptions) (string, error) {
+	if opt.Namespace == "" {
+		opt.Namespace = "default"
+	}
+	if opt.ClusterClassNamespace == "" {
+		opt.ClusterClassNamespace = opt.Namespace
+	}
+	if opt.ControlPlaneReplicas == 0 {
+		opt.ControlPlaneReplicas = 1
+	}
+	if opt.ControlPlaneReplicas%2 == 0 || opt.ControlPlaneReplicas < 0 {
+		return "", fmt.Errorf("%w: control plane replicas must be an odd number, got %d", ErrInvalidReplicas, opt.ControlPlaneReplicas)
+	}
+
+	cluster, err := newTopologyCluster(opt)
+	if err != nil {
+		return "", err
+	}
+
+	class, err := c.GetClusterClass(ctx, opt.ClusterClass, opt.ClusterClassNamespace)
+	if err != nil {
+		return "", err
+	}
+	if err := validateTopology(class, cluster.Spec.Topology); err != nil {
+		return "", err
+	}
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cluster)
+	if err != nil {
+		return "", err
+	}
+	unstructured.RemoveNestedField(obj, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(obj, "status")
+
+	b, err := yaml.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// PatchClusterTopology scales or upgrades a cluster with a managed topology, the topology
+// controller rolls out the change. The patched topology is validated against the ClusterClass
+// and only applied when the cluster hasn't changed since it was read.
+func (c *ClusterApiClient) PatchClusterTopology(ctx context.Context, clusterName, namespace string, opt option.PatchTopologyOptions) (*clusterv1.Cluster, error) {
+	cluster, err := c.GetCluster(ctx, clusterName, namespace)
+	if err != nil {
+		return nil, err
+	}
+	topology := cluster.Spec.Topology
+	if topology == nil {
+		return nil, fmt.Errorf("%w: cluster %s/%s has no managed topology", ErrInvalidTopology, namespace, clusterName)
+	}
+
+	if opt.KubernetesVersion != "" {
+		topology.Version = opt.KubernetesVersion
+	}
+	if opt.ControlPlaneReplicas != nil {
+		replicas := *opt.ControlPlaneReplicas
+		if replicas < 1 || replicas%2 == 0 {
+			return nil, fmt.Errorf("%w: control plane replicas must be an odd number, got %d", ErrInvalidReplicas, replicas)
+		}
+		topology.ControlPlane.Replicas = &replicas
+	}
+	for name, replicas := range opt.MachineDeploymentReplicas {
+		if replicas < 0 {
+			return nil, fmt.Errorf("%w: machine deployment replicas must not be negative, got %d", ErrInvalidReplicas, replicas)
+		}
+		found := false
+		if topology.Workers != nil {
+			for i := range topology.Workers.MachineDeployments {
+				if topology.Workers.MachineDeployments[i].Name == name {
+					replicas := replicas
+					topology.Workers.MachineDeployments[i].Replicas = &replicas
+					found = true
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: machine deployment %s is not in the topology of cluster %s/%s", ErrInvalidTopology, name, namespace, clusterName)
+		}
+	}
+	if len(opt.Variables) > 0 {
+		variables, err := newClusterVariables(opt.Variables)
+		if err != nil {
+			return nil, err
+		}
+		for _, variable := range variables {
+			replaced := false
+			for i := range topology.Variables {
+				if topology.Variables[i].Name == variable.Name {
+					topology.Variables[i].Value = variable.Value
+					replaced = true
+				}
+			}
+			if !replaced {
+				topology.Variables = append(topology.Variables, variable)
+			}
+		}
+	}
+
+	classNamespace := topology.ClassNamespace
+	if classNamespace == "" {
+		classNamespace = namespace
+	}
+	class, err := c.GetClusterClass(ctx, topology.Class, classNamespace)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateTopology(class, topology); err != nil {
+		return nil, err
+	}
+
+	// the whole topology is sent so that the machine deployment and variable lists are replaced,
+	// the resource version makes the patch fail if the cluster changed in between
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"resourceVersion": cluster.ResourceVersion},
+		"spec":     map[string]interface{}{"topology": topology},
+	})
+	if err != nil {
+		return nil, err
+	}
+	obj, err := c.DynamicInterface.Resource(clusterResource).
+		Namespace(namespace).
+		Patch(ctx, clusterName, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	updated := &clusterv1.Cluster{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func newTopologyCluster(opt option.GenerateTopologyClusterOptions) (*clusterv1.Cluster, error) {
+	variables, err := newClusterVariables(opt.Variables)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster := &clusterv1.Cluster{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: clusterv1.GroupVersion.String(),
+			Kind:       "Cluster",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      opt.ClusterName,
+			Namespace: opt.Namespace,
+		},
+		Spec: clusterv1.ClusterSpec{
+			Topology: &clusterv1.Topology{
+				Class:     opt.ClusterClass,
+				Version:   opt.KubernetesVersion,
+				Variables: variables,
+				ControlPlane: clusterv1.ControlPlaneTopology{
+					Replicas: &opt.ControlPlaneReplicas,
+				},
+			},
+		},
+	}
+	if opt.ClusterClassNamespace != opt.Namespace {
+		cluster.Spec.Topology.ClassNamespace = opt.ClusterClassNamespace
+	}
+	if len(opt.PodCidrBlocks) > 0 || len(opt.ServiceCidrBlocks) > 0 {
+		cluster.Spec.ClusterNetwork = &clusterv1.ClusterNetwork{}
+		if len(opt.PodCidrBlocks) > 0 {
+			cluster.Spec.ClusterNetwork.Pods = &clusterv1.NetworkRanges{CIDRBlocks: opt.PodCidrBlocks}
+		}
+		if len(opt.ServiceCidrBlocks) > 0 {
+			cluster.Spec.ClusterNetwork.Services = &clusterv1.NetworkRanges{CIDRBlocks: opt.ServiceCidrBlocks}
+		}
+	}
+
+	if len(opt.MachineDeployments) > 0 {
+		cluster.Spec.Topology.Workers = &clusterv1.WorkersTopology{}
+	}
+	for _, md := range opt.MachineDeployments {
+		if md.Replicas < 0 {
+			return nil, fmt.Errorf("%w: machine deployment replicas must not be negative, got %d", ErrInvalidReplicas, md.Replicas)
+		}
+		replicas := md.Replicas
+		topology := clusterv1.MachineDeploymentTopology{
+			Name:     md.Name,
+			Class:    md.Class,
+			Replicas: &replicas,
+		}
+		if md.FailureDomain != "" {
+			failureDomain := md.FailureDomain
+			topology.FailureDomain = &failureDomain
+		}
+		if len(md.Variables) > 0 {
+			overrides, err := newClusterVariables(md.Variables)
+			if err != nil {
+				return nil, err
+			}
+			topology.Variables = &clusterv1.MachineDeploymentVariables{Overrides: overrides}
+		}
+		cluster.Spec.Topology.Workers.MachineDeployments = append(cluster.Spec.Topology.Workers.MachineDeployments, topology)
+	}
+
+	return cluster, nil
+}
+
+// newClusterVariables returns the variables sorted by name to keep the generated YAML stable.
+func newClusterVariables(values map[string]interface{}) ([]clusterv1.ClusterVariable, error) {
+	variables := []clusterv1.ClusterVariable{}
+	for name, value := range values {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: variable %s: %w", ErrInvalidTopology, name, err)
+		}
+		variables = append(variables, clusterv1.ClusterVariable{
+			Name:  name,
+			Value: apiextensionsv1.JSON{Raw: raw},
+		})
+	}
+	sort.Slice(variables, func(i, j int) bool {
+		return variables[i].Name < variables[j].Name
+	})
+
+	return variables, nil
+}
+
+// validateTopology returns ErrInvalidTopology listing every unknown machine deployment class,
+// unknown or missing required variable and variable value that doesn't match its schema.
+func validateTopology(class *clusterv1.ClusterClass, topology *clusterv1.Topology) error {
+	problems := []string{}
+
+	classes := map[string]bool{}
+	for _, md := range class.Spec.Workers.MachineDeployments {
+		classes[md.Class] = true
+	}
+	if topology.Workers != nil {
+		for _, md := range topology.Workers.MachineDeployments {
+			if !classes[md.Class] {
+				problems = append(problems, fmt.Sprintf("machine deployment %s: class %s is not defined in ClusterClass %s", md.Name, md.Class, class.Name))
+			}
+		}
+	}
+
+	definitions := clusterClassVariables(class)
+	set := map[string]bool{}
+	for _, variable := range topology.Variables {
+		set[variable.Name] = true
+		problems = append(problems, validateClusterVariable(definitions, variable, field.NewPath("variables"))...)
+	}
+	names := []string{}
+	for name := range definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if definitions[name].Required && !set[name] {
+			problems = append(problems, fmt.Sprintf("variable %s is required", name))
+		}
+	}
+	if topology.Workers != nil {
+		for _, md := range topology.Workers.MachineDeployments {
+			if md.Variables == nil {
+				continue
+			}
+			for _, variable := range md.Variables.Overrides {
+				path := field.NewPath("machineDeployments").Key(md.Name).Child("variables")
+				problems = append(problems, validateClusterVariable(definitions, variable, path)...)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidTopology, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// clusterClassVariables returns the variable definitions of a ClusterClass. The status includes
+// the variables defined by runtime extensions, the spec is used until the ClusterClass has
+// been reconciled.
+func clusterClassVariables(class *clusterv1.ClusterClass) map[string]clusterv1.ClusterClassVariable {
+	definitions := map[string]clusterv1.ClusterClassVariable{}
+	for _, variable := range class.Spec.Variables {
+		definitions[variable.Name] = variable
+	}
+	for _, variable := range class.Status.Variables {
+		if len(variable.Definitions) == 0 {
+			continue
+		}
+		definitions[variable.Name] = clusterv1.ClusterClassVariable{
+			Name:     variable.Name,
+			Required: variable.Definitions[0].Required,
+			Schema:   variable.Definitions[0].Schema,
+		}
+	}
+
+	return definitions
+}
+
+func validateClusterVariable(definitions map[string]clusterv1.ClusterClassVariable, variable clusterv1.ClusterVariable, path *field.Path) []string {
+	definition, ok := definitions[variable.Name]
+	if !ok {
+		return []string{fmt.Sprintf("variable %s is not defined in the ClusterClass", variable.Name)}
+	}
+
+	validator, err := newVariableSchemaValidator(definition.Schema.OpenAPIV3Schema)
+	if err != nil {
+		return []string{fmt.Sprintf("variable %s: invalid schema: %s", variable.Name, err)}
+	}
+	var value interface{}
+	if err := json.Unmarshal(variable.Value.Raw, &value); err != nil {
+		return []string{fmt.Sprintf("variable %s: %s", variable.Name, err)}
+	}
+
+	problems := []string{}
+	for _, err := range validation.ValidateCustomResource(path.Key(variable.Name), value, validator) {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
+
+// newVariableSchemaValidator converts the variable schema of a ClusterClass into a CRD schema,
+// both share the same JSON representation.
+func newVariableSchemaValidator(schema clusterv1.JSONSchemaProps) (validation.SchemaValidator, error) {
+	b, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	v1Schema := &apiextensionsv1.JSONSchemaProps{}
+	if err := json.Unmarshal(b, v1Schema); err != nil {
+		return nil, err
+	}
+	internalSchema := &apiextensions.JSONSchemaProps{}
+	if err := apiextensionsv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(v1Schema, internalSchema, nil); err != nil {
+		return nil, err
+	}
+
+	validator, _, err := validation.NewSchemaValidator(internalSchema)
+	return validator, err
+}
@@ -0,0 +1,399 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/LyridInc/cluster-api-go-sdk/model"
+	"github.com/LyridInc/cluster-api-go-sdk/option"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// PlanClusterUpgrade builds the ordered steps to upgrade the control plane and then every
+// MachineDeployment of the cluster, rejecting upgrades that skip a minor version.
+func (c *ClusterApiClient) PlanClusterUpgrade(ctx context.Context, clusterName, namespace string, opt option.UpgradeClusterOptions) (*model.UpgradePlan, error) {
+	cluster, err := c.GetCluster(ctx, clusterName, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	ref := cluster.Spec.ControlPlaneRef
+	if ref == nil || ref.Kind != "KubeadmControlPlane" {
+		return nil, fmt.Errorf("%w: cluster %s/%s is not managed by a KubeadmControlPlane", ErrInvalidUpgrade, namespace, clusterName)
+	}
+
+	kcp, err := c.GetKubeadmControlPlane(ctx, ref.Name, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateUpgradeVersion(kcp.Spec.Version, opt.KubernetesVersion); err != nil {
+		return nil, err
+	}
+
+	plan := &model.UpgradePlan{
+		ClusterName:    clusterName,
+		Namespace:      namespace,
+		FromVersion:    kcp.Spec.Version,
+		ToVersion:      opt.KubernetesVersion,
+		ImageFieldPath: opt.ImageFieldPath,
+	}
+
+	infraRef := kcp.Spec.MachineTemplate.InfrastructureRef
+	plan.Steps = append(plan.Steps, model.UpgradeStep{
+		Kind:               "KubeadmControlPlane",
+		Name:               kcp.Name,
+		TemplateApiVersion: infraRef.APIVersion,
+		TemplateKind:       infraRef.Kind,
+		TemplateName:       infraRef.Name,
+		Image:              opt.ControlPlaneImage,
+		Status:             model.UpgradeStepPending,
+	})
+
+	machineDeployments, err := c.ListMachineDeployments(ctx, namespace, ClusterLabelSelector(clusterName))
+	if err != nil {
+		return nil, err
+	}
+	for _, md := range machineDeployments.Items {
+		if md.Spec.Template.Spec.Version != nil {
+			if err := validateUpgradeVersion(*md.Spec.Template.Spec.Version, opt.KubernetesVersion); err != nil {
+				return nil, fmt.Errorf("machine deployment %s: %w", md.Name, err)
+			}
+		}
+
+		infraRef := md.Spec.Template.Spec.InfrastructureRef
+		plan.Steps = append(plan.Steps, model.UpgradeStep{
+			Kind:               "MachineDeployment",
+			Name:               md.Name,
+			TemplateApiVersion: infraRef.APIVersion,
+			TemplateKind:       infraRef.Kind,
+			TemplateName:       infraRef.Name,
+			Image:              opt.WorkerImage,
+			Status:             model.UpgradeStepPending,
+		})
+	}
+
+	return plan, nil
+}
+
+// UpgradeCluster executes the pending steps of the plan in order and waits for each of them
+// to roll out. Completed steps are skipped, so a persisted plan can be passed again to resume.
+// onPlanChange, when not nil, is called with the updated plan after every step transition so
+// it can be persisted.
+func (c *ClusterApiClient) UpgradeCluster(ctx context.Context, plan *model.UpgradePlan, opt option.UpgradeOptions, onPlanChange func(model.UpgradePlan)) error {
+	notify := func() {
+		if onPlanChange != nil {
+			onPlanChange(*plan)
+		}
+	}
+
+	for i := range plan.Steps {
+		step := &plan.Steps[i]
+		if step.Status == model.UpgradeStepCompleted {
+			continue
+		}
+
+		if step.Status != model.UpgradeStepApplied {
+			now := time.Now()
+			step.StartedAt = &now
+			if err := c.applyUpgradeStep(ctx, plan, step); err != nil {
+				step.Message = err.Error()
+				notify()
+				return err
+			}
+			step.Status = model.UpgradeStepApplied
+			step.Message = ""
+			notify()
+		}
+
+		if err := c.waitForUpgradeStep(ctx, plan, step, opt); err != nil {
+			step.Message = err.Error()
+			notify()
+			return err
+		}
+
+		now := time.Now()
+		step.CompletedAt = &now
+		step.Status = model.UpgradeStepCompleted
+		step.Message = ""
+		notify()
+	}
+
+	return nil
+}
+
+func (c *ClusterApiClient) applyUpgradeStep(ctx context.Context, plan *model.UpgradePlan, step *model.UpgradeStep) error {
+	templateName := step.TemplateName
+	if step.Image != "" {
+		if step.NewTemplateName == "" {
+			step.NewTemplateName = upgradeTemplateName(step.Name, plan.ToVersion)
+		}
+		if err := c.cloneMachineTemplate(ctx, plan, step); err != nil {
+			return err
+		}
+		templateName = step.NewTemplateName
+	}
+
+	var (
+		resource schema.GroupVersionResource
+		patch    map[string]interface{}
+	)
+	switch step.Kind {
+	case "KubeadmControlPlane":
+		resource = kubeadmControlPlaneResource
+		patch = map[string]interface{}{
+			"spec": map[string]interface{}{
+				"version": plan.ToVersion,
+				"machineTemplate": map[string]interface{}{
+					"infrastructureRef": map[string]interface{}{"name": templateName},
+				},
+			},
+		}
+	case "MachineDeployment":
+		resource = machineDeploymentResource
+		patch = map[string]interface{}{
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"version":           plan.ToVersion,
+						"infrastructureRef": map[string]interface{}{"name": templateName},
+					},
+				},
+			},
+		}
+	default:
+		return fmt.Errorf("%w: unsupported step kind %s", ErrInvalidUpgrade, step.Kind)
+	}
+
+	b, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.DynamicInterface.Resource(resource).
+		Namespace(plan.Namespace).
+		Patch(ctx, step.Name, types.MergePatchType, b, metav1.PatchOptions{})
+
+	return err
+}
+
+// cloneMachineTemplate copies the current machine template with the new image,
+// machine templates are immutable so a rollout needs a new object.
+func (c *ClusterApiClient) cloneMachineTemplate(ctx context.Context, plan *model.UpgradePlan, step *model.UpgradeStep) error {
+	gvk := schema.FromAPIVersionAndKind(step.TemplateApiVersion, step.TemplateKind)
+	mapping, err := c.restMapping(gvk)
+	if err != nil {
+		return err
+	}
+	dri := c.DynamicInterface.Resource(mapping.Resource).Namespace(plan.Namespace)
+
+	template, err := dri.Get(ctx, step.TemplateName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	clone := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": template.GetAPIVersion(),
+		"kind":       template.GetKind(),
+		"spec":       template.Object["spec"],
+	}}
+	clone.SetName(step.NewTemplateName)
+	clone.SetNamespace(plan.Namespace)
+	clone.SetLabels(template.GetLabels())
+	clone.SetAnnotations(template.GetAnnotations())
+	clone.SetOwnerReferences(template.GetOwnerReferences())
+
+	if err := setMachineTemplateImage(clone, step.Image, plan.ImageFieldPath); err != nil {
+		return err
+	}
+
+	if _, err := dri.Create(ctx, clone, metav1.CreateOptions{}); err != nil && !k8serrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	return nil
+}
+
+func setMachineTemplateImage(template *unstructured.Unstructured, image string, imageFieldPath []string) error {
+	if len(imageFieldPath) > 0 {
+		return unstructured.SetNestedField(template.Object, image, imageFieldPath...)
+	}
+
+	candidates, ok := option.MachineTemplateImageFields[template.GetKind()]
+	if !ok {
+		return fmt.Errorf("%w: unknown image field for %s, set ImageFieldPath", ErrInvalidUpgrade, template.GetKind())
+	}
+
+	for _, path := range candidates {
+		if _, found, _ := unstructured.NestedFieldNoCopy(template.Object, path...); found {
+			return unstructured.SetNestedField(template.Object, image, path...)
+		}
+	}
+
+	return unstructured.SetNestedField(template.Object, image, candidates[0]...)
+}
+
+func (c *ClusterApiClient) waitForUpgradeStep(ctx context.Context, plan *model.UpgradePlan, step *model.UpgradeStep, opt option.UpgradeOptions) error {
+	timeout := opt.Timeout
+	if timeout == 0 {
+		timeout = 60 * time.Minute
+	}
+	interval := opt.PollInterval
+	if interval == 0 {
+		interval = 15 * time.Second
+	}
+
+	var notReady *ClusterNotReadyError
+	err := wait.PollUntilContextTimeout(ctx, interval, timeout, true, func(ctx context.Context) (bool, error) {
+		var (
+			desired    *int32
+			status     model.ClusterObjectStatus
+			rolledOut  bool
+			rollout    string
+			generation int64
+			observed   int64
+		)
+		switch step.Kind {
+		case "KubeadmControlPlane":
+			kcp, err := c.GetKubeadmControlPlane(ctx, step.Name, plan.Namespace)
+			if err != nil {
+				return false, err
+			}
+			desired = kcp.Spec.Replicas
+			status = newClusterObjectStatus(step.Kind, kcp.ObjectMeta, kcp.Status.Conditions)
+			status.Replicas, status.ReadyReplicas, status.UpdatedReplicas = kcp.Status.Replicas, kcp.Status.ReadyReplicas, kcp.Status.UpdatedReplicas
+			rolledOut = kcp.Status.Version != nil && *kcp.Status.Version == plan.ToVersion
+			generation, observed = kcp.Generation, kcp.Status.ObservedGeneration
+		case "MachineDeployment":
+			md, err := c.GetMachineDeployment(ctx, step.Name, plan.Namespace)
+			if err != nil {
+				return false, err
+			}
+			desired = md.Spec.Replicas
+			status = newClusterObjectStatus(step.Kind, md.ObjectMeta, md.Status.Conditions)
+			status.Replicas, status.ReadyReplicas, status.UpdatedReplicas = md.Status.Replicas, md.Status.ReadyReplicas, md.Status.UpdatedReplicas
+			rolledOut, rollout, err = c.machineDeploymentRolledOut(ctx, plan, step, md.Spec.Replicas)
+			if err != nil {
+				return false, err
+			}
+			generation, observed = md.Generation, md.Status.ObservedGeneration
+		}
+
+		replicas := int32(1)
+		if desired != nil {
+			replicas = *desired
+		}
+		if observed >= generation && rolledOut && status.Replicas == replicas && replicasReady(desired, status.ReadyReplicas, status.UpdatedReplicas) {
+			return true, nil
+		}
+
+		message := fmt.Sprintf("%d/%d replicas updated, %d ready, %d total",
+			status.UpdatedReplicas, replicas, status.ReadyReplicas, status.Replicas)
+		if rollout != "" {
+			message = message + ", " + rollout
+		}
+		notReady = &ClusterNotReadyError{
+			Kind:          step.Kind,
+			Name:          step.Name,
+			Namespace:     plan.Namespace,
+			ConditionType: status.ConditionType,
+			Reason:        status.Reason,
+			Message:       message,
+		}
+		return false, nil
+	})
+	if err != nil {
+		if wait.Interrupted(err) && notReady != nil {
+			notReady.Err = err
+			return notReady
+		}
+		return err
+	}
+
+	return nil
+}
+
+// machineDeploymentRolledOut checks that the machine deployment only has the desired number of
+// machines, all from a MachineSet with the target version and machine template, Running and
+// with a node. Otherwise it describes the first machine that isn't updated.
+func (c *ClusterApiClient) machineDeploymentRolledOut(ctx context.Context, plan *model.UpgradePlan, step *model.UpgradeStep, desired *int32) (bool, string, error) {
+	templateName := step.TemplateName
+	if step.NewTemplateName != "" {
+		templateName = step.NewTemplateName
+	}
+	selector := clusterv1.MachineDeploymentNameLabel + "=" + step.Name
+
+	machineSets, err := c.ListMachineSets(ctx, plan.Namespace, selector)
+	if err != nil {
+		return false, "", err
+	}
+	updatedSets := map[string]bool{}
+	for _, ms := range machineSets.Items {
+		spec := ms.Spec.Template.Spec
+		if spec.Version != nil && *spec.Version == plan.ToVersion && spec.InfrastructureRef.Name == templateName {
+			updatedSets[ms.Name] = true
+		}
+	}
+
+	machines, err := c.ListMachines(ctx, plan.Namespace, selector)
+	if err != nil {
+		return false, "", err
+	}
+	for _, machine := range machines.Items {
+		owner := metav1.GetControllerOf(&machine)
+		switch {
+		case owner == nil || owner.Kind != "MachineSet" || !updatedSets[owner.Name]:
+			return false, fmt.Sprintf("machine %s has the previous machine template", machine.Name), nil
+		case machine.Spec.Version == nil || *machine.Spec.Version != plan.ToVersion:
+			return false, fmt.Sprintf("machine %s is not on version %s", machine.Name, plan.ToVersion), nil
+		case machine.Status.GetTypedPhase() != clusterv1.MachinePhaseRunning || machine.Status.NodeRef == nil:
+			return false, fmt.Sprintf("machine %s is %s", machine.Name, machine.Status.Phase), nil
+		}
+	}
+
+	replicas := int32(1)
+	if desired != nil {
+		replicas = *desired
+	}
+	if int32(len(machines.Items)) != replicas {
+		return false, fmt.Sprintf("%d/%d machines", len(machines.Items), replicas), nil
+	}
+
+	return true, "", nil
+}
+
+// validateUpgradeVersion allows staying on the same version or moving up by at most one minor version.
+func validateUpgradeVersion(current, target string) error {
+	currentVersion, err := version.ParseSemantic(current)
+	if err != nil {
+		return fmt.Errorf("%w: current version %q: %w", ErrInvalidUpgrade, current, err)
+	}
+	targetVersion, err := version.ParseSemantic(target)
+	if err != nil {
+		return fmt.Errorf("%w: target version %q: %w", ErrInvalidUpgrade, target, err)
+	}
+
+	if targetVersion.LessThan(currentVersion) {
+		return fmt.Errorf("%w: downgrade from %s to %s is not supported", ErrInvalidUpgrade, current, target)
+	}
+	if targetVersion.Major() != currentVersion.Major() || targetVersion.Minor() > currentVersion.Minor()+1 {
+		return fmt.Errorf("%w: upgrade from %s to %s skips a minor version", ErrInvalidUpgrade, current, target)
+	}
+
+	return nil
+}
+
+func upgradeTemplateName(name, kubernetesVersion string) string {
+	suffix := strings.NewReplacer(".", "-", "+", "-").Replace(strings.ToLower(kubernetesVersion))
+	return name + "-" + suffix
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/LyridInc/cluster-api-go-sdk/model"
+	"github.com/LyridInc/cluster-api-go-sdk/option"
+	"sigs.k8s.io/cluster-api/cmd/clusterctl/client"
+	"sigs.k8s.io/cluster-api/cmd/clusterctl/client/config"
+)
+
+// variablesConfig is a clusterctl config whose template variables are resolved from a map
+// first and then from the clusterctl config file and the environment. Variables set by
+// clusterctl while rendering, e.g. CLUSTER_NAME, only go to the map so that concurrent
+// renders don't see each other's values.
+type variablesConfig struct {
+	config.Client
+	variables *variablesClient
+}
+
+type variablesClient struct {
+	base      config.VariablesClient
+	variables map[string]string
+}
+
+func (c *variablesConfig) Variables() config.VariablesClient {
+	return c.variables
+}
+
+func (v *variablesClient) Get(key string) (string, error) {
+	if value, ok := v.variables[key]; ok {
+		return value, nil
+	}
+	return v.base.Get(key)
+}
+
+func (v *variablesClient) Set(key, value string) {
+	v.variables[key] = value
+}
+
+func (c *ClusterApiClient) newVariablesConfig(ctx context.Context, variables map[string]string) (*variablesConfig, error) {
+	base, err := config.New(ctx, c.ConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrClusterctlConfig, err)
+	}
+
+	vars := make(map[string]string, len(variables))
+	for key, value := range variables {
+		vars[key] = value
+	}
+
+	return &variablesConfig{
+		Client:    base,
+		variables: &variablesClient{base: base.Variables(), variables: vars},
+	}, nil
+}
+
+// clusterctlClientWithVariables returns a clusterctl client for a single call that renders
+// templates with the given variables.
+func (c *ClusterApiClient) clusterctlClientWithVariables(ctx context.Context, variables map[string]string) (client.Client, error) {
+	configClient, err := c.newVariablesConfig(ctx, variables)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.newClusterctlClient(ctx, configClient, nil)
+}
+
+func (c *ClusterApiClient) getClusterTemplateYaml(ctx context.Context, templateOptions client.GetClusterTemplateOptions, variables map[string]string) (string, error) {
+	cl, err := c.clusterctlClientWithVariables(ctx, variables)
+	if err != nil {
+		return "", err
+	}
+
+	template, err := cl.GetClusterTemplate(ctx, templateOptions)
+	if err != nil {
+		return "", err
+	}
+
+	yaml, err := template.Yaml()
+	if err != nil {
+		return "", err
+	}
+
+	return string(yaml), nil
+}
+
+// ListTemplateVariables returns the variables of the cluster template selected by opt, sorted by
+// name. Variables without a default value are required.
+func (c *ClusterApiClient) ListTemplateVariables(ctx context.Context, opt option.GenerateWorkloadClusterOptions) ([]model.TemplateVariable, error) {
+	configClient, err := c.newVariablesConfig(ctx, opt.Variables)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.listTemplateVariables(ctx, configClient, opt)
+}
+
+// ValidateTemplateVariables checks opt.Variables against the variables of the cluster template
+// and returns every missing and unused variable at once. The error wraps ErrMissingTemplateVariables
+// when a required variable is neither in opt.Variables, set from the other options, nor defined in
+// the clusterctl config or the environment.
+func (c *ClusterApiClient) ValidateTemplateVariables(ctx context.Context, opt option.GenerateWorkloadClusterOptions) (*model.TemplateVariablesValidation, error) {
+	configClient, err := c.newVariablesConfig(ctx, opt.Variables)
+	if err != nil {
+		return nil, err
+	}
+
+	variables, err := c.listTemplateVariables(ctx, configClient, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	validation := &model.TemplateVariablesValidation{
+		Missing: []string{},
+		Unused:  []string{},
+	}
+	used := map[string]bool{}
+	for _, variable := range variables {
+		used[variable.Name] = true
+		if !variable.Required || templateOptionVariables[variable.Name] {
+			continue
+		}
+		if _, ok := opt.Variables[variable.Name]; ok {
+			continue
+		}
+		if _, err := configClient.variables.base.Get(variable.Name); err == nil {
+			continue
+		}
+		validation.Missing = append(validation.Missing, variable.Name)
+	}
+	for name := range opt.Variables {
+		if !used[name] {
+			validation.Unused = append(validation.Unused, name)
+		}
+	}
+	sort.Strings(validation.Unused)
+
+	if len(validation.Missing) > 0 {
+		return validation, fmt.Errorf("%w: %s", ErrMissingTemplateVariables, strings.Join(validation.Missing, ", "))
+	}
+	return validation, nil
+}
+
+// templateOptionVariables are set by clusterctl from GetClusterTemplateOptions.
+var templateOptionVariables = map[string]bool{
+	"CLUSTER_NAME":                true,
+	"NAMESPACE":                   true,
+	"KUBERNETES_VERSION":          true,
+	"CONTROL_PLANE_MACHINE_COUNT": true,
+	"WORKER_MACHINE_COUNT":        true,
+}
+
+func (c *ClusterApiClient) listTemplateVariables(ctx context.Context, configClient *variablesConfig, opt option.GenerateWorkloadClusterOptions) ([]model.TemplateVariable, error) {
+	cl, err := c.newClusterctlClient(ctx, configClient, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// clusterctl validates the cluster name even when only listing variables
+	if opt.ClusterName == "" {
+		opt.ClusterName = "cluster"
+	}
+	templateOptions := c.workloadClusterTemplateOptions(opt)
+	templateOptions.ListVariablesOnly = true
+
+	template, err := cl.GetClusterTemplate(ctx, templateOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	variables := []model.TemplateVariable{}
+	for name, defaultValue := range template.VariableMap() {
+		variables = append(variables, model.TemplateVariable{
+			Name:     name,
+			Required: defaultValue == nil,
+			Default:  defaultValue,
+		})
+	}
+	sort.Slice(variables, func(i, j int) bool {
+		return variables[i].Name < variables[j].Name
+	})
+
+	return variables, nil
+}
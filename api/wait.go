@@ -0,0 +1,307 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/LyridInc/cluster-api-go-sdk/model"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+type (
+	WaitForClusterReadyOptions struct {
+		// Timeout defaults to 30 minutes.
+		Timeout time.Duration
+		// PollInterval is the interval between checks when no watch event arrives, defaults to
+		// 10 seconds.
+		PollInterval time.Duration
+		// OnProgress is called whenever the phase, machine counts or conditions of an object change.
+		OnProgress func(model.ClusterProgressEvent)
+		// Events receives the same events as OnProgress, sends are dropped once the context is done.
+		Events chan<- model.ClusterProgressEvent
+	}
+
+	// ClusterNotReadyError is returned when a cluster doesn't become ready in time,
+	// it describes the first object that was still not ready.
+	ClusterNotReadyError struct {
+		Kind          string
+		Name          string
+		Namespace     string
+		ConditionType string
+		Reason        string
+		Message       string
+		Err           error
+	}
+)
+
+func (e *ClusterNotReadyError) Error() string {
+	msg := fmt.Sprintf("%s %s/%s is not ready", e.Kind, e.Namespace, e.Name)
+	if e.ConditionType != "" {
+		msg = fmt.Sprintf("%s: condition %s", msg, e.ConditionType)
+	}
+	if e.Reason != "" {
+		msg = fmt.Sprintf("%s (%s)", msg, e.Reason)
+	}
+	if e.Message != "" {
+		msg = fmt.Sprintf("%s: %s", msg, e.Message)
+	}
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, e.Err)
+	}
+	return msg
+}
+
+func (e *ClusterNotReadyError) Unwrap() error {
+	return e.Err
+}
+
+// WaitForClusterReady blocks until the Cluster, its KubeadmControlPlane and all of
+// its MachineDeployments are ready, reporting every change through the options callbacks.
+// The readiness is checked again on every watch event of these objects and every
+// PollInterval, so a watch that can't be opened or ends only delays the checks.
+func (c *ClusterApiClient) WaitForClusterReady(ctx context.Context, clusterName, namespace string, opt WaitForClusterReadyOptions) error {
+	timeout := opt.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Minute
+	}
+	interval := opt.PollInterval
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	changes := c.watchClusterObjects(ctx, clusterName, namespace, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	statuses := map[string]model.ClusterObjectStatus{}
+	var notReady *ClusterNotReadyError
+
+	for {
+		current, objNotReady, err := c.clusterReadiness(ctx, clusterName, namespace)
+		switch {
+		case err == nil:
+			for _, status := range current {
+				key := status.Kind + "/" + status.Name
+				previous, ok := statuses[key]
+				if ok && previous == status {
+					continue
+				}
+
+				event := model.ClusterProgressEvent{Time: time.Now(), Status: status}
+				if ok {
+					event.Previous = &previous
+				}
+				emitClusterProgressEvent(ctx, opt, event)
+				statuses[key] = status
+			}
+
+			notReady = objNotReady
+			if notReady == nil {
+				return nil
+			}
+		case k8serrors.IsNotFound(err):
+			notReady = &ClusterNotReadyError{Kind: "Cluster", Name: clusterName, Namespace: namespace, Message: err.Error()}
+		case ctx.Err() == nil:
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			if notReady != nil {
+				notReady.Err = ctx.Err()
+				return notReady
+			}
+			return ctx.Err()
+		case <-changes:
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchClusterObjects watches the Cluster, the KubeadmControlPlanes of the namespace and the
+// MachineDeployments of the cluster until ctx is done. The returned channel receives a value
+// when any of them changes, a watch that ends is opened again after interval.
+func (c *ClusterApiClient) watchClusterObjects(ctx context.Context, clusterName, namespace string, interval time.Duration) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	watches := []struct {
+		resource schema.GroupVersionResource
+		options  metav1.ListOptions
+	}{
+		{clusterResource, metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", clusterName).String()}},
+		// the control plane isn't required to have the cluster label
+		{kubeadmControlPlaneResource, metav1.ListOptions{}},
+		{machineDeploymentResource, metav1.ListOptions{LabelSelector: ClusterLabelSelector(clusterName)}},
+	}
+
+	for _, w := range watches {
+		go func(resource schema.GroupVersionResource, options metav1.ListOptions) {
+			for {
+				watcher, err := c.DynamicInterface.Resource(resource).Namespace(namespace).Watch(ctx, options)
+				if err == nil {
+					forwardWatchEvents(ctx, watcher, changes)
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(interval):
+				}
+			}
+		}(w.resource, w.options)
+	}
+
+	return changes
+}
+
+// forwardWatchEvents signals changes for every event until the watch ends, changes has a
+// buffer of one so that a burst of events triggers a single check.
+func forwardWatchEvents(ctx context.Context, watcher watch.Interface, changes chan<- struct{}) {
+	defer watcher.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-watcher.ResultChan():
+			if !ok {
+				return
+			}
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func emitClusterProgressEvent(ctx context.Context, opt WaitForClusterReadyOptions, event model.ClusterProgressEvent) {
+	if opt.OnProgress != nil {
+		opt.OnProgress(event)
+	}
+	if opt.Events != nil {
+		select {
+		case opt.Events <- event:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// clusterReadiness returns the status of every object the cluster readiness depends on
+// and the first object that is not ready yet.
+func (c *ClusterApiClient) clusterReadiness(ctx context.Context, clusterName, namespace string) ([]model.ClusterObjectStatus, *ClusterNotReadyError, error) {
+	statuses := []model.ClusterObjectStatus{}
+	var notReady *ClusterNotReadyError
+	markNotReady := func(status model.ClusterObjectStatus) {
+		if notReady == nil && !status.Ready {
+			notReady = &ClusterNotReadyError{
+				Kind:          status.Kind,
+				Name:          status.Name,
+				Namespace:     status.Namespace,
+				ConditionType: status.ConditionType,
+				Reason:        status.Reason,
+				Message:       status.Message,
+			}
+		}
+	}
+
+	cluster, err := c.GetCluster(ctx, clusterName, namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	clusterStatus := newClusterObjectStatus("Cluster", cluster.ObjectMeta, cluster.Status.Conditions)
+	clusterStatus.Phase = cluster.Status.Phase
+	clusterStatus.Ready = clusterStatus.Ready && cluster.Status.GetTypedPhase() == clusterv1.ClusterPhaseProvisioned
+	statuses = append(statuses, clusterStatus)
+	markNotReady(clusterStatus)
+
+	ref := cluster.Spec.ControlPlaneRef
+	if ref != nil && ref.Kind == "KubeadmControlPlane" {
+		kcp, err := c.GetKubeadmControlPlane(ctx, ref.Name, namespace)
+		if err != nil {
+			return nil, nil, err
+		}
+		kcpStatus := newClusterObjectStatus("KubeadmControlPlane", kcp.ObjectMeta, kcp.Status.Conditions)
+		kcpStatus.Replicas = kcp.Status.Replicas
+		kcpStatus.ReadyReplicas = kcp.Status.ReadyReplicas
+		kcpStatus.UpdatedReplicas = kcp.Status.UpdatedReplicas
+		if kcp.Status.Initialized {
+			kcpStatus.Phase = "Initialized"
+		}
+		kcpStatus.Ready = kcpStatus.Ready && kcp.Status.Ready && replicasReady(kcp.Spec.Replicas, kcp.Status.ReadyReplicas, kcp.Status.UpdatedReplicas)
+		statuses = append(statuses, kcpStatus)
+		markNotReady(kcpStatus)
+	}
+
+	machineDeployments, err := c.ListMachineDeployments(ctx, namespace, ClusterLabelSelector(clusterName))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, md := range machineDeployments.Items {
+		mdStatus := newClusterObjectStatus("MachineDeployment", md.ObjectMeta, md.Status.Conditions)
+		mdStatus.Phase = md.Status.Phase
+		mdStatus.Replicas = md.Status.Replicas
+		mdStatus.ReadyReplicas = md.Status.ReadyReplicas
+		mdStatus.UpdatedReplicas = md.Status.UpdatedReplicas
+		mdStatus.Ready = mdStatus.Ready &&
+			md.Status.GetTypedPhase() == clusterv1.MachineDeploymentPhaseRunning &&
+			replicasReady(md.Spec.Replicas, md.Status.ReadyReplicas, md.Status.UpdatedReplicas)
+		statuses = append(statuses, mdStatus)
+		markNotReady(mdStatus)
+	}
+
+	return statuses, notReady, nil
+}
+
+// newClusterObjectStatus decides the readiness from the Ready condition. The other conditions
+// only explain a Ready condition that is not true, e.g. when it has no reason.
+func newClusterObjectStatus(kind string, meta metav1.ObjectMeta, conditions clusterv1.Conditions) model.ClusterObjectStatus {
+	status := model.ClusterObjectStatus{
+		Kind:      kind,
+		Name:      meta.Name,
+		Namespace: meta.Namespace,
+	}
+
+	var ready, failing *clusterv1.Condition
+	for i, condition := range conditions {
+		if condition.Type == clusterv1.ReadyCondition {
+			ready = &conditions[i]
+		} else if failing == nil && condition.Status != v1.ConditionTrue {
+			failing = &conditions[i]
+		}
+	}
+
+	switch {
+	case ready == nil:
+		status.ConditionType = string(clusterv1.ReadyCondition)
+		status.Reason = "ConditionNotReported"
+	case ready.Status == v1.ConditionTrue:
+		status.Ready = true
+	case ready.Reason == "" && failing != nil:
+		status.ConditionType = string(failing.Type)
+		status.Reason = failing.Reason
+		status.Message = failing.Message
+	default:
+		status.ConditionType = string(ready.Type)
+		status.Reason = ready.Reason
+		status.Message = ready.Message
+	}
+
+	return status
+}
+
+func replicasReady(desired *int32, ready, updated int32) bool {
+	replicas := int32(1)
+	if desired != nil {
+		replicas = *desired
+	}
+	return ready == replicas && updated == replicas
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/cluster-api/util/secret"
+)
+
+type workloadClientEntry struct {
+	// resourceVersion of the kubeconfig secret the clients were built from
+	resourceVersion string
+	clusterApi      *ClusterApiClient
+	helm            *HelmClient
+}
+
+// WorkloadClient returns the clients of a workload cluster built from its kubeconfig secret.
+// The clients are cached per cluster and rebuilt when the secret changes, e.g. after the
+// certificates were rotated. The dialer and proxy set with WithWorkloadDialer and
+// WithWorkloadProxy are used to reach the API server of the workload cluster.
+func (c *ClusterApiClient) WorkloadClient(ctx context.Context, clusterName, namespace string) (*ClusterApiClient, *HelmClient, error) {
+	key := namespace + "/" + clusterName
+	kubeconfigSecret, err := c.Clientset.CoreV1().Secrets(namespace).Get(ctx, secret.Name(clusterName, secret.Kubeconfig), metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			c.ForgetWorkloadClient(clusterName, namespace)
+		}
+		return nil, nil, err
+	}
+
+	c.workloadMu.Lock()
+	defer c.workloadMu.Unlock()
+
+	if entry, ok := c.workloadClients[key]; ok && entry.resourceVersion == kubeconfigSecret.ResourceVersion {
+		return entry.clusterApi, entry.helm, nil
+	}
+
+	kubeconfig, ok := kubeconfigSecret.Data[secret.KubeconfigDataName]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: secret %s/%s has no %s key", ErrInvalidKubeconfig, namespace, kubeconfigSecret.Name, secret.KubeconfigDataName)
+	}
+
+	clusterApi, err := NewClusterApiClientWithOptions(
+		WithKubeconfigBytes(kubeconfig),
+		WithClusterctlConfigFile(c.ConfigFile),
+		withTransport(c.workloadDial, c.workloadProxy),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	helm, err := NewHelmClientFromRestConfig(rest.CopyConfig(clusterApi.Config), "default")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if c.workloadClients == nil {
+		c.workloadClients = map[string]*workloadClientEntry{}
+	}
+	c.workloadClients[key] = &workloadClientEntry{
+		resourceVersion: kubeconfigSecret.ResourceVersion,
+		clusterApi:      clusterApi,
+		helm:            helm,
+	}
+
+	return clusterApi, helm, nil
+}
+
+// ForgetWorkloadClient removes the cached clients of a workload cluster, e.g. after the
+// cluster was deleted.
+func (c *ClusterApiClient) ForgetWorkloadClient(clusterName, namespace string) {
+	c.workloadMu.Lock()
+	defer c.workloadMu.Unlock()
+
+	delete(c.workloadClients, namespace+"/"+clusterName)
+}
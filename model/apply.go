@@ -0,0 +1,44 @@
+package model
+
+const (
+	ApplyStatusCreated    = "created"
+	ApplyStatusConfigured = "configured"
+	ApplyStatusUnchanged  = "unchanged"
+	ApplyStatusConflict   = "conflict"
+)
+
+type ApplyResult struct {
+	ApiVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace,omitempty"`
+	Status     string `json:"status"`
+	Message    string `json:"message,omitempty"`
+}
+
+const (
+	DiffActionCreate   = "create"
+	DiffActionUpdate   = "update"
+	DiffActionDelete   = "delete"
+	DiffActionNone     = "none"
+	DiffActionConflict = "conflict"
+)
+
+type JsonPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+type ObjectDiff struct {
+	ApiVersion string                 `json:"apiVersion"`
+	Kind       string                 `json:"kind"`
+	Name       string                 `json:"name"`
+	Namespace  string                 `json:"namespace,omitempty"`
+	Action     string                 `json:"action"`
+	Message    string                 `json:"message,omitempty"`
+	Live       map[string]interface{} `json:"live,omitempty"`
+	Desired    map[string]interface{} `json:"desired,omitempty"`
+	Diff       string                 `json:"diff"`
+	JsonPatch  []JsonPatchOperation   `json:"jsonPatch"`
+}
@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+type WorkloadCleanup struct {
+	DeletedServices               []string `json:"deletedServices"`
+	DeletedPersistentVolumeClaims []string `json:"deletedPersistentVolumeClaims"`
+	// InUsePersistentVolumeClaims maps the claims that were kept to the pods mounting them,
+	// their volumes are released with the machines instead.
+	InUsePersistentVolumeClaims map[string][]string `json:"inUsePersistentVolumeClaims,omitempty"`
+	RemainingServices           []string            `json:"remainingServices,omitempty"`
+	RemainingPersistentVolumes  []string            `json:"remainingPersistentVolumes,omitempty"`
+	Errors                      []string            `json:"errors,omitempty"`
+}
+
+type StuckObject struct {
+	ApiVersion        string     `json:"apiVersion"`
+	Kind              string     `json:"kind"`
+	Name              string     `json:"name"`
+	Namespace         string     `json:"namespace,omitempty"`
+	Finalizers        []string   `json:"finalizers,omitempty"`
+	DeletionTimestamp *time.Time `json:"deletionTimestamp,omitempty"`
+	Reason            string     `json:"reason,omitempty"`
+	Message           string     `json:"message,omitempty"`
+}
+
+type ClusterDeletionReport struct {
+	ClusterName     string          `json:"clusterName"`
+	Namespace       string          `json:"namespace"`
+	Deleted         bool            `json:"deleted"`
+	WorkloadCleanup WorkloadCleanup `json:"workloadCleanup"`
+	StuckObjects    []StuckObject   `json:"stuckObjects"`
+}
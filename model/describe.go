@@ -0,0 +1,54 @@
+package model
+
+import "time"
+
+type ClusterStatusCondition struct {
+	Type               string     `json:"type"`
+	Status             string     `json:"status"`
+	Severity           string     `json:"severity,omitempty"`
+	Reason             string     `json:"reason,omitempty"`
+	Message            string     `json:"message,omitempty"`
+	LastTransitionTime *time.Time `json:"lastTransitionTime,omitempty"`
+}
+
+type ClusterStatusNode struct {
+	ApiVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace,omitempty"`
+	// DisplayName is the name clusterctl shows for the node, e.g. ControlPlane or Workers
+	DisplayName        string                   `json:"displayName,omitempty"`
+	Virtual            bool                     `json:"virtual,omitempty"`
+	Group              bool                     `json:"group,omitempty"`
+	GroupItems         []string                 `json:"groupItems,omitempty"`
+	Ready              bool                     `json:"ready"`
+	Status             string                   `json:"status,omitempty"`
+	Severity           string                   `json:"severity,omitempty"`
+	Reason             string                   `json:"reason,omitempty"`
+	Message            string                   `json:"message,omitempty"`
+	LastTransitionTime *time.Time               `json:"lastTransitionTime,omitempty"`
+	Conditions         []ClusterStatusCondition `json:"conditions,omitempty"`
+	Children           []ClusterStatusNode      `json:"children,omitempty"`
+}
+
+type UnhealthyObject struct {
+	// Path is the chain of display names from the Cluster down to the object
+	Path               []string   `json:"path"`
+	ApiVersion         string     `json:"apiVersion,omitempty"`
+	Kind               string     `json:"kind"`
+	Name               string     `json:"name"`
+	Namespace          string     `json:"namespace,omitempty"`
+	Status             string     `json:"status"`
+	Severity           string     `json:"severity,omitempty"`
+	Reason             string     `json:"reason,omitempty"`
+	Message            string     `json:"message,omitempty"`
+	LastTransitionTime *time.Time `json:"lastTransitionTime,omitempty"`
+}
+
+type ClusterStatusReport struct {
+	ClusterName string            `json:"clusterName"`
+	Namespace   string            `json:"namespace"`
+	Ready       bool              `json:"ready"`
+	Tree        ClusterStatusNode `json:"tree"`
+	Unhealthy   []UnhealthyObject `json:"unhealthy"`
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+type ClusterObjectStatus struct {
+	Kind            string `json:"kind"`
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	Phase           string `json:"phase,omitempty"`
+	Replicas        int32  `json:"replicas"`
+	ReadyReplicas   int32  `json:"readyReplicas"`
+	UpdatedReplicas int32  `json:"updatedReplicas"`
+	Ready           bool   `json:"ready"`
+	ConditionType   string `json:"conditionType,omitempty"`
+	Reason          string `json:"reason,omitempty"`
+	Message         string `json:"message,omitempty"`
+}
+
+type ClusterProgressEvent struct {
+	Time     time.Time            `json:"time"`
+	Status   ClusterObjectStatus  `json:"status"`
+	Previous *ClusterObjectStatus `json:"previous,omitempty"`
+}
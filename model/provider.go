@@ -0,0 +1,22 @@
+package model
+
+type Provider struct {
+	Name             string `json:"name"`
+	Type             string `json:"type"`
+	Namespace        string `json:"namespace"`
+	CurrentVersion   string `json:"currentVersion"`
+	AvailableVersion string `json:"availableVersion,omitempty"`
+	WatchedNamespace string `json:"watchedNamespace,omitempty"`
+}
+
+type ProviderUpgradePlan struct {
+	// Contract is the Cluster API contract the providers are upgraded to, e.g. v1beta1
+	Contract  string     `json:"contract"`
+	Providers []Provider `json:"providers"`
+}
+
+type ProviderStatus struct {
+	Provider
+	Available bool   `json:"available"`
+	Message   string `json:"message,omitempty"`
+}
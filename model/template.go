@@ -0,0 +1,12 @@
+package model
+
+type TemplateVariable struct {
+	Name     string  `json:"name"`
+	Required bool    `json:"required"`
+	Default  *string `json:"default,omitempty"`
+}
+
+type TemplateVariablesValidation struct {
+	Missing []string `json:"missing"`
+	Unused  []string `json:"unused"`
+}
@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+const (
+	UpgradeStepPending   = "pending"
+	UpgradeStepApplied   = "applied"
+	UpgradeStepCompleted = "completed"
+)
+
+// UpgradePlan is JSON-serializable so that it can be persisted between steps
+// and handed back to UpgradeCluster to resume an interrupted upgrade.
+type UpgradePlan struct {
+	ClusterName    string        `json:"clusterName"`
+	Namespace      string        `json:"namespace"`
+	FromVersion    string        `json:"fromVersion"`
+	ToVersion      string        `json:"toVersion"`
+	ImageFieldPath []string      `json:"imageFieldPath,omitempty"`
+	Steps          []UpgradeStep `json:"steps"`
+}
+
+type UpgradeStep struct {
+	Kind               string     `json:"kind"`
+	Name               string     `json:"name"`
+	TemplateApiVersion string     `json:"templateApiVersion"`
+	TemplateKind       string     `json:"templateKind"`
+	TemplateName       string     `json:"templateName"`
+	NewTemplateName    string     `json:"newTemplateName,omitempty"`
+	Image              string     `json:"image,omitempty"`
+	Status             string     `json:"status"`
+	Message            string     `json:"message,omitempty"`
+	StartedAt          *time.Time `json:"startedAt,omitempty"`
+	CompletedAt        *time.Time `json:"completedAt,omitempty"`
+}
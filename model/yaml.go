@@ -44,75 +44,204 @@ type (
 		Username                    string `yaml:"username" json:"username"`
 		Password                    string `yaml:"password" json:"password"`
 	}
-	Clouds struct {
-		Openstack Openstack `yaml:"openstack" json:"openstack"`
-	}
+	// Clouds are the clouds of a clouds.yaml by name.
+	Clouds map[string]Openstack
+
 	CloudsYaml struct {
 		Clouds Clouds `yaml:"clouds" json:"clouds"`
+		// Cloud is the name of the cloud used by TemplateVariables, like OS_CLOUD. It defaults to
+		// the only cloud of the file, or "openstack" when there are several and it exists.
+		Cloud string `yaml:"-" json:"-"`
+
+		content []byte
 	}
 )
 
-var yamlContent string
+const DEFAULT_CLOUD_NAME = "openstack"
 
+// Parse reads a clouds.yaml and keeps its content for the OPENSTACK_CLOUD_YAML_B64 variable.
 func (y *CloudsYaml) Parse(yamlByte []byte) error {
-	err := yaml.Unmarshal(yamlByte, &y)
+	if err := yaml.Unmarshal(yamlByte, y); err != nil {
+		return err
+	}
+	y.content = yamlByte
+	return nil
+}
+
+// MergeSecure merges a secure.yaml, which usually holds the passwords and application
+// credential secrets, into the parsed clouds.yaml. Values of secure.yaml take precedence.
+func (y *CloudsYaml) MergeSecure(secureByte []byte) error {
+	clouds := map[interface{}]interface{}{}
+	if err := yaml.Unmarshal(y.Content(), &clouds); err != nil {
+		return err
+	}
+	secure := map[interface{}]interface{}{}
+	if err := yaml.Unmarshal(secureByte, &secure); err != nil {
+		return err
+	}
+	mergeYamlMaps(clouds, secure)
+
+	content, err := yaml.Marshal(clouds)
+	if err != nil {
+		return err
+	}
+	return y.Parse(content)
+}
+
+func mergeYamlMaps(dst, src map[interface{}]interface{}) {
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[interface{}]interface{})
+		dstMap, dstIsMap := dst[key].(map[interface{}]interface{})
+		if srcIsMap && dstIsMap {
+			mergeYamlMaps(dstMap, srcMap)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// Content returns the clouds.yaml given to Parse, or the marshaled clouds when the
+// CloudsYaml wasn't parsed.
+func (y *CloudsYaml) Content() []byte {
+	if y.content != nil {
+		return y.content
+	}
+	content, _ := yaml.Marshal(y)
+	return content
+}
+
+// SelectCloud sets the cloud used by TemplateVariables.
+func (y *CloudsYaml) SelectCloud(name string) error {
+	if _, ok := y.Clouds[name]; !ok {
+		return fmt.Errorf("cloud %s not found in clouds.yaml", name)
+	}
+	y.Cloud = name
+	return nil
+}
+
+// CloudName returns the name of the selected cloud, an error is returned when the clouds.yaml
+// doesn't have it.
+func (y *CloudsYaml) CloudName() (string, error) {
+	name := y.Cloud
+	if name == "" && len(y.Clouds) == 1 {
+		for cloud := range y.Clouds {
+			name = cloud
+		}
+	}
+	if name == "" {
+		name = DEFAULT_CLOUD_NAME
+	}
+	if _, ok := y.Clouds[name]; !ok {
+		return "", fmt.Errorf("cloud %s not found in clouds.yaml, select one of the %d clouds with SelectCloud", name, len(y.Clouds))
+	}
+	return name, nil
+}
+
+// SelectedCloud returns the selected cloud.
+func (y *CloudsYaml) SelectedCloud() (Openstack, error) {
+	name, err := y.CloudName()
+	if err != nil {
+		return Openstack{}, err
+	}
+	return y.Clouds[name], nil
+}
+
+// SelectedCloudContent returns a clouds.yaml with only the selected cloud, so that the
+// credentials of the other clouds don't end up in the workload cluster. The fields of the
+// cloud are kept as they are in Content.
+func (y *CloudsYaml) SelectedCloudContent() ([]byte, error) {
+	name, err := y.CloudName()
+	if err != nil {
+		return nil, err
+	}
+
+	content := struct {
+		Clouds map[string]interface{} `yaml:"clouds"`
+	}{}
+	if err := yaml.Unmarshal(y.Content(), &content); err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(map[string]interface{}{
+		"clouds": map[string]interface{}{name: content.Clouds[name]},
+	})
+}
+
+// SetEnvironment exports the variables of TemplateVariables to the process environment.
+//
+// Deprecated: the environment is shared by every goroutine, pass TemplateVariables in
+// option.GenerateWorkloadClusterOptions.Variables instead.
+func (y *CloudsYaml) SetEnvironment(options option.OpenstackGenerateClusterOptions) error {
+	variables, err := y.TemplateVariables(options)
 	if err != nil {
 		return err
 	}
-	yamlContent = string(yamlByte)
+	for key, value := range variables {
+		os.Setenv(key, value)
+	}
 	return nil
 }
 
-func (y *CloudsYaml) SetEnvironment(options option.OpenstackGenerateClusterOptions) {
+// TemplateVariables returns the variables of the OpenStack cluster templates for the
+// selected cloud, including the generated cloud.conf of the cloud provider.
+func (y *CloudsYaml) TemplateVariables(options option.OpenstackGenerateClusterOptions) (map[string]string, error) {
+	variables := map[string]string{}
 
-	cloud := "openstack"
-	cloudOs := y.Clouds.Openstack
+	cloud, err := y.CloudName()
+	if err != nil {
+		return nil, err
+	}
+	cloudOs := y.Clouds[cloud]
+	cloudYaml, err := y.SelectedCloudContent()
+	if err != nil {
+		return nil, err
+	}
 	authOs := cloudOs.Auth
 	openstackConf := "[Global]\n"
 
-	// set env.rc variables
-	os.Setenv("CAPO_AUTH_URL", authOs.AuthUrl)
+	// env.rc variables
+	variables["CAPO_AUTH_URL"] = authOs.AuthUrl
 	openstackConf = openstackConf + `auth-url="` + authOs.AuthUrl + "\"\n"
 
 	if authOs.Username != "" {
-		os.Setenv("CAPO_USERNAME", authOs.Username)
+		variables["CAPO_USERNAME"] = authOs.Username
 		openstackConf = openstackConf + `username="` + authOs.Username + "\"\n"
 	}
 	if authOs.Password != "" {
-		os.Setenv("CAPO_PASSWORD", authOs.Password)
+		variables["CAPO_PASSWORD"] = authOs.Password
 		openstackConf = openstackConf + `password="` + authOs.Password + "\"\n"
 	}
 
-	os.Setenv("CAPO_PROJECT_ID", authOs.ProjectId)
+	variables["CAPO_PROJECT_ID"] = authOs.ProjectId
 	openstackConf = openstackConf + `tenant-id="` + authOs.ProjectId + "\"\n"
 
-	os.Setenv("CAPO_PROJECT_NAME", authOs.ProjectName)
+	variables["CAPO_PROJECT_NAME"] = authOs.ProjectName
 	openstackConf = openstackConf + `tenant-name="` + authOs.ProjectName + "\"\n"
 
-	os.Setenv("CAPO_DOMAIN_NAME", authOs.UserDomainName)
+	variables["CAPO_DOMAIN_NAME"] = authOs.UserDomainName
 	openstackConf = openstackConf + `domain-name="` + authOs.UserDomainName + "\"\n"
 
-	os.Setenv("CAPO_DOMAIN_ID", authOs.UserDomainId)
+	variables["CAPO_DOMAIN_ID"] = authOs.UserDomainId
 	openstackConf = openstackConf + `domain-id="` + authOs.UserDomainId + "\"\n"
 
 	caCertB64 := base64.StdEncoding.EncodeToString([]byte(cloudOs.CaCert + "\n"))
-	os.Setenv("OPENSTACK_CLOUD_CACERT_B64", caCertB64)
+	variables["OPENSTACK_CLOUD_CACERT_B64"] = caCertB64
 	if cloudOs.CaCert != "" {
 		openstackConf = openstackConf + `ca-file="/etc/certs/cacert"` + "\n"
 	}
 
 	if authOs.ApplicationCredentialName != "" {
-		os.Setenv("CAPO_APPLICATION_CREDENTIAL_NAME", authOs.ApplicationCredentialName)
+		variables["CAPO_APPLICATION_CREDENTIAL_NAME"] = authOs.ApplicationCredentialName
 		openstackConf = openstackConf + `application-credential-name="` + authOs.ApplicationCredentialName + "\"\n"
 	}
 
 	if authOs.ApplicationCredentialId != "" {
-		os.Setenv("CAPO_APPLICATION_CREDENTIAL_ID", authOs.ApplicationCredentialId)
+		variables["CAPO_APPLICATION_CREDENTIAL_ID"] = authOs.ApplicationCredentialId
 		openstackConf = openstackConf + `application-credential-id="` + authOs.ApplicationCredentialId + "\"\n"
 	}
 
 	if authOs.ApplicationCredentialSecret != "" {
-		os.Setenv("CAPO_APPLICATION_CREDENTIAL_SECRET", authOs.ApplicationCredentialSecret)
+		variables["CAPO_APPLICATION_CREDENTIAL_SECRET"] = authOs.ApplicationCredentialSecret
 		openstackConf = openstackConf + `application-credential-secret="` + authOs.ApplicationCredentialSecret + "\"\n"
 	}
 
@@ -125,23 +254,23 @@ func (y *CloudsYaml) SetEnvironment(options option.OpenstackGenerateClusterOptio
 	}
 
 	if cloudOs.LbMethod != "" {
-		os.Setenv("CAPO_LB_METHOD", cloudOs.LbMethod)
+		variables["CAPO_LB_METHOD"] = cloudOs.LbMethod
 		openstackConf = openstackConf + `lb-method="` + cloudOs.LbMethod + "\"\n"
 	}
 	if cloudOs.CreateMonitor {
-		os.Setenv("CAPO_CREATE_MONITOR", fmt.Sprint(cloudOs.CreateMonitor))
+		variables["CAPO_CREATE_MONITOR"] = fmt.Sprint(cloudOs.CreateMonitor)
 		openstackConf = openstackConf + `create-monitor="` + fmt.Sprint(cloudOs.CreateMonitor) + "\"\n"
 	}
 	if cloudOs.MonitorDelay != "" {
-		os.Setenv("CAPO_MONITOR_DELAY", cloudOs.MonitorDelay)
+		variables["CAPO_MONITOR_DELAY"] = cloudOs.MonitorDelay
 		openstackConf = openstackConf + `monitor-delay="` + cloudOs.MonitorDelay + "\"\n"
 	}
 	if cloudOs.MonitorMaxRetries != 0 {
-		os.Setenv("CAPO_MONITOR_MAX_RETRIES", fmt.Sprint(cloudOs.MonitorMaxRetries))
+		variables["CAPO_MONITOR_MAX_RETRIES"] = fmt.Sprint(cloudOs.MonitorMaxRetries)
 		openstackConf = openstackConf + `monitor-max-retries="` + fmt.Sprint(cloudOs.MonitorMaxRetries) + "\"\n"
 	}
 	if cloudOs.MonitorTimeout != "" {
-		os.Setenv("CAPO_MONITOR_TIMEOUT", cloudOs.MonitorTimeout)
+		variables["CAPO_MONITOR_TIMEOUT"] = cloudOs.MonitorTimeout
 		openstackConf = openstackConf + `monitor-timeout="` + cloudOs.MonitorTimeout + "\"\n"
 	}
 
@@ -151,37 +280,39 @@ func (y *CloudsYaml) SetEnvironment(options option.OpenstackGenerateClusterOptio
 	}
 
 	openstackConfB64 := base64.StdEncoding.EncodeToString([]byte(openstackConf))
-	cloudYamlB64 := base64.StdEncoding.EncodeToString([]byte(yamlContent))
+	cloudYamlB64 := base64.StdEncoding.EncodeToString(cloudYaml)
 
-	os.Setenv("OPENSTACK_CLOUD", cloud)
-	os.Setenv("OPENSTACK_CLOUD_PROVIDER_CONF", openstackConf)
-	os.Setenv("OPENSTACK_CLOUD_PROVIDER_CONF_B64", openstackConfB64)
-	os.Setenv("OPENSTACK_CLOUD_YAML_B64", cloudYamlB64)
+	variables["OPENSTACK_CLOUD"] = cloud
+	variables["OPENSTACK_CLOUD_PROVIDER_CONF"] = openstackConf
+	variables["OPENSTACK_CLOUD_PROVIDER_CONF_B64"] = openstackConfB64
+	variables["OPENSTACK_CLOUD_YAML_B64"] = cloudYamlB64
 
-	// set generate cluster options
+	// generate cluster options
 	if options.ControlPlaneMachineFlavor != "" {
-		os.Setenv("OPENSTACK_CONTROL_PLANE_MACHINE_FLAVOR", options.ControlPlaneMachineFlavor)
+		variables["OPENSTACK_CONTROL_PLANE_MACHINE_FLAVOR"] = options.ControlPlaneMachineFlavor
 	}
 	if options.NodeMachineFlavor != "" {
-		os.Setenv("OPENSTACK_NODE_MACHINE_FLAVOR", options.NodeMachineFlavor)
+		variables["OPENSTACK_NODE_MACHINE_FLAVOR"] = options.NodeMachineFlavor
 	}
 	if options.ExternalNetworkId != "" {
-		os.Setenv("OPENSTACK_EXTERNAL_NETWORK_ID", options.ExternalNetworkId)
+		variables["OPENSTACK_EXTERNAL_NETWORK_ID"] = options.ExternalNetworkId
 	}
 	if options.ImageName != "" {
-		os.Setenv("OPENSTACK_IMAGE_NAME", options.ImageName)
+		variables["OPENSTACK_IMAGE_NAME"] = options.ImageName
 	}
 	if options.SshKeyName != "" {
-		os.Setenv("OPENSTACK_SSH_KEY_NAME", options.SshKeyName)
+		variables["OPENSTACK_SSH_KEY_NAME"] = options.SshKeyName
 	}
 	if options.DnsNameServers != "" {
 		dnsNameServers := strings.Split(options.DnsNameServers, ",")
 		dnsServersString := strings.Join(dnsNameServers, "\n    - ")
-		os.Setenv("OPENSTACK_DNS_NAMESERVERS", dnsServersString)
+		variables["OPENSTACK_DNS_NAMESERVERS"] = dnsServersString
 	}
 	if options.FailureDomain != "" {
-		os.Setenv("OPENSTACK_FAILURE_DOMAIN", options.FailureDomain)
+		variables["OPENSTACK_FAILURE_DOMAIN"] = options.FailureDomain
 	}
+
+	return variables, nil
 }
 
 func ReadYamlFromUrl(url string) (string, error) {
@@ -1,5 +1,7 @@
 package option
 
+import "time"
+
 type (
 	OpenstackGenerateClusterOptions struct {
 		ControlPlaneMachineFlavor string
@@ -9,7 +11,8 @@ type (
 		SshKeyName                string
 		DnsNameServers            string
 		FailureDomain             string
-		IgnoreVolumeAZ            bool
+		// IgnoreVolumeAZ adds ignore-volume-az to the [BlockStorage] section of the cloud.conf.
+		IgnoreVolumeAZ bool
 	}
 
 	GenerateWorkloadClusterOptions struct {
@@ -21,6 +24,28 @@ type (
 		InfrastructureProvider   string
 		Flavor                   string
 		URL                      string
+		// Variables are the template variables of this generation only, e.g. the result of
+		// model.CloudsYaml.TemplateVariables. The process environment is used as fallback.
+		Variables map[string]string
+	}
+
+	GenerateOpenstackWorkloadClusterOption struct {
+		ClusterName              string
+		Namespace                string
+		KubernetesVersion        string
+		WorkerMachineCount       int64
+		ControlPlaneMachineCount int64
+		Flavor                   string
+		URL                      string
+		// CloudsYaml is the content of the clouds.yaml with the credentials of the cloud, SecureYaml
+		// is an optional secure.yaml merged into it.
+		CloudsYaml []byte
+		SecureYaml []byte
+		// Cloud selects the cloud of the clouds.yaml, like OS_CLOUD.
+		Cloud string
+		OpenstackGenerateClusterOptions
+		// ManagedSubnets replace the managed subnets of the OpenStackCluster.
+		ManagedSubnets []ManagedSubnet
 	}
 
 	GenerateOciWorkloadClusterOption struct {
@@ -87,6 +112,56 @@ type (
 		NetworkName             string
 	}
 
+	GenerateAzureWorkloadClusterOption struct {
+		ClusterName              string
+		Namespace                string
+		KubernetesVersion        string
+		WorkerMachineCount       int64
+		ControlPlaneMachineCount int64
+		SubscriptionID           string
+		TenantID                 string
+		Location                 string
+		// ResourceGroup defaults to the cluster name in the default template.
+		ResourceGroup           string
+		ControlPlaneMachineType string
+		NodeMachineType         string
+		// ClientID and the identity secret are used by the AzureClusterIdentity of the template.
+		ClientID                       string
+		ClusterIdentityName            string
+		ClusterIdentitySecretName      string
+		ClusterIdentitySecretNamespace string
+		// SshPublicKey is base64 encoded into AZURE_SSH_PUBLIC_KEY_B64.
+		SshPublicKey string
+		Flavor       string
+		URL          string
+	}
+
+	GenerateVSphereWorkloadClusterOption struct {
+		ClusterName              string
+		Namespace                string
+		KubernetesVersion        string
+		WorkerMachineCount       int64
+		ControlPlaneMachineCount int64
+		Server                   string
+		Username                 string
+		Password                 string
+		TlsThumbprint            string
+		Datacenter               string
+		Datastore                string
+		Network                  string
+		ResourcePool             string
+		Folder                   string
+		// Template is the VM template the machines are cloned from.
+		Template      string
+		StoragePolicy string
+		// ControlPlaneEndpointIP is the kube-vip address of the control plane.
+		ControlPlaneEndpointIP   string
+		ControlPlaneEndpointPort int32
+		SshAuthorizedKey         string
+		Flavor                   string
+		URL                      string
+	}
+
 	ClusterKindSpecOption struct {
 		CidrBlocks []string
 	}
@@ -126,6 +201,90 @@ type (
 		StorageClassName string
 	}
 
+	ServerSideApplyOptions struct {
+		FieldManager   string
+		ForceConflicts bool
+	}
+
+	UpgradeClusterOptions struct {
+		KubernetesVersion string
+		// ControlPlaneImage and WorkerImage roll the machines onto a cloned machine template
+		// with the new image, the existing templates are reused when empty.
+		ControlPlaneImage string
+		WorkerImage       string
+		// ImageFieldPath overrides MachineTemplateImageFields for the machine template kind.
+		ImageFieldPath []string
+	}
+
+	UpgradeOptions struct {
+		// Timeout bounds every step of the plan, defaults to 60 minutes.
+		Timeout time.Duration
+		// PollInterval defaults to 15 seconds.
+		PollInterval time.Duration
+	}
+
+	// InitProvider is a provider name from the clusterctl provider list, e.g. "k0sproject-k0smotron"
+	// or "rke2", the latest release is installed when Version is empty.
+	InitProvider struct {
+		Name    string
+		Version string
+	}
+
+	InitInfrastructureOptions struct {
+		// CoreProvider defaults to cluster-api. When the core provider isn't installed yet,
+		// BootstrapProviders and ControlPlaneProviders default to kubeadm.
+		CoreProvider              InitProvider
+		BootstrapProviders        []InitProvider
+		ControlPlaneProviders     []InitProvider
+		InfrastructureProviders   []InitProvider
+		IPAMProviders             []InitProvider
+		RuntimeExtensionProviders []InitProvider
+		AddonProviders            []InitProvider
+		// TargetNamespace installs every provider into the same namespace instead of the
+		// default namespace of each provider.
+		TargetNamespace string
+		WaitProviders   bool
+		// WaitProviderTimeout defaults to 5 minutes.
+		WaitProviderTimeout    time.Duration
+		IgnoreValidationErrors bool
+	}
+
+	// TopologyMachineDeployment is a worker pool of a managed topology cluster, Class is one of
+	// the machine deployment classes of the ClusterClass.
+	TopologyMachineDeployment struct {
+		Name          string
+		Class         string
+		Replicas      int32
+		FailureDomain string
+		// Variables override the cluster variables for this pool only.
+		Variables map[string]interface{}
+	}
+
+	GenerateTopologyClusterOptions struct {
+		ClusterName  string
+		Namespace    string
+		ClusterClass string
+		// ClusterClassNamespace defaults to Namespace.
+		ClusterClassNamespace string
+		KubernetesVersion     string
+		ControlPlaneReplicas  int32
+		MachineDeployments    []TopologyMachineDeployment
+		// Variables are validated against the variable schemas of the ClusterClass.
+		Variables         map[string]interface{}
+		PodCidrBlocks     []string
+		ServiceCidrBlocks []string
+	}
+
+	PatchTopologyOptions struct {
+		// KubernetesVersion upgrades the control plane first and then the machine deployments.
+		KubernetesVersion    string
+		ControlPlaneReplicas *int32
+		// MachineDeploymentReplicas scales the machine deployments by their topology name.
+		MachineDeploymentReplicas map[string]int32
+		// Variables are added to or replace the cluster variables.
+		Variables map[string]interface{}
+	}
+
 	ManifestOption struct {
 		ClusterKindSpecOption           ClusterKindSpecOption
 		InfrastructureKindSpecOption    InfrastructureKindSpecOption
@@ -135,11 +294,76 @@ type (
 		DaemonSetKindOption             DaemonSetKindOption
 		PersistentVolumeClaimKindOption PersistentVolumeClaimKindOption
 	}
+
+	// ManifestPatchTarget selects the objects of a manifest a patch applies to, empty fields
+	// match every object.
+	ManifestPatchTarget struct {
+		Group     string
+		Version   string
+		Kind      string
+		Name      string
+		Namespace string
+		// LabelSelector is matched against the labels of the object, e.g. "app=csi-cinder-nodeplugin".
+		LabelSelector string
+	}
+
+	ManifestPatchType string
+
+	// ManifestPatch is one step of a manifest transformation. Patch is the strategic merge patch
+	// or the JSON 6902 operations, in YAML or JSON. Path and Value are used by a JSONPath set,
+	// e.g. Path `{.spec.template.spec.volumes[?(@.name=="cloud-config")].secret.secretName}`.
+	ManifestPatch struct {
+		Target ManifestPatchTarget
+		Type   ManifestPatchType
+		Patch  string
+		Path   string
+		Value  interface{}
+	}
+)
+
+const (
+	// ManifestPatchStrategicMerge falls back to a JSON merge patch for kinds without a patch
+	// strategy, e.g. custom resources.
+	ManifestPatchStrategicMerge ManifestPatchType = "StrategicMerge"
+	ManifestPatchJSON6902       ManifestPatchType = "JSON6902"
+	// ManifestPatchJSONPathSet sets Value at every field matched by Path, missing object fields
+	// are created.
+	ManifestPatchJSONPathSet ManifestPatchType = "JSONPathSet"
 )
 
+const DEFAULT_FIELD_MANAGER = "cluster-api-go-sdk"
+
+// Namespaces are the default namespaces of the infrastructure providers, used for readiness
+// checks when a provider isn't in the clusterctl inventory.
 var Namespaces map[string]string = map[string]string{
-	"openstack": "capo-system",
-	"oci":       "capoci-system",
+	"openstack":  "capo-system",
+	"oci":        "capoci-system",
+	"aws":        "capa-system",
+	"gcp":        "capg-system",
+	"cloudstack": "capc-system",
+	"azure":      "capz-system",
+	"vsphere":    "capv-system",
+}
+
+// ClusterApiNamespaces are the default namespaces of the core, bootstrap and control plane
+// providers, used for readiness checks when the core provider isn't in the clusterctl inventory.
+var ClusterApiNamespaces []string = []string{
+	"capi-system",
+	"capi-kubeadm-bootstrap-system",
+	"capi-kubeadm-control-plane-system",
+}
+
+// MachineTemplateImageFields lists the candidate image fields of each infrastructure machine template,
+// the first field present in the template is used.
+var MachineTemplateImageFields map[string][][]string = map[string][][]string{
+	"OpenStackMachineTemplate": {
+		{"spec", "template", "spec", "imageName"},
+		{"spec", "template", "spec", "image", "filter", "name"},
+	},
+	"AWSMachineTemplate":        {{"spec", "template", "spec", "ami", "id"}},
+	"GCPMachineTemplate":        {{"spec", "template", "spec", "image"}},
+	"OCIMachineTemplate":        {{"spec", "template", "spec", "imageId"}},
+	"CloudStackMachineTemplate": {{"spec", "template", "spec", "template", "name"}},
 }
 
 const FLANNEL_MANIFEST_URL = "https://raw.githubusercontent.com/flannel-io/flannel/master/Documentation/kube-flannel.yml"
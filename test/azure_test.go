@@ -0,0 +1,49 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/LyridInc/cluster-api-go-sdk/api"
+	"github.com/LyridInc/cluster-api-go-sdk/option"
+)
+
+// go test ./test -v -run ^TestGenerateAzureClusterTemplate$
+func TestGenerateAzureClusterTemplate(t *testing.T) {
+	infrastructure := "azure"
+	capi, _ := api.NewClusterApiClient("", "./data/capi-management-cluster/capi-management-cluster.kubeconfig")
+
+	clusterName := "capz-tenant"
+	ready, err := capi.InfrastructureReadiness(infrastructure)
+	if !ready && err == nil {
+		t.Log("initialize infrastructure")
+		capi.InitInfrastructure(infrastructure)
+	}
+
+	t.Log("Generate workload cluster YAML")
+	clusterOpt := option.GenerateAzureWorkloadClusterOption{
+		ClusterName:                    clusterName,
+		Namespace:                      "default",
+		KubernetesVersion:              "v1.30.11",
+		WorkerMachineCount:             2,
+		ControlPlaneMachineCount:       1,
+		SubscriptionID:                 os.Getenv("AZURE_SUBSCRIPTION_ID"),
+		TenantID:                       os.Getenv("AZURE_TENANT_ID"),
+		ClientID:                       os.Getenv("AZURE_CLIENT_ID"),
+		Location:                       "westus2",
+		ControlPlaneMachineType:        "Standard_D2s_v3",
+		NodeMachineType:                "Standard_D2s_v3",
+		ClusterIdentityName:            "cluster-identity",
+		ClusterIdentitySecretName:      "cluster-identity-secret",
+		ClusterIdentitySecretNamespace: "default",
+	}
+	yaml, err := capi.GenerateAzureWorkloadClusterYaml(clusterOpt)
+	if err != nil {
+		t.Fatal("Generate workload cluster error:", err)
+	}
+
+	if err := os.WriteFile(fmt.Sprintf("./data/%s.yaml", clusterName), []byte(yaml), 0644); err != nil {
+		t.Fatal("Write yaml error:", err)
+	}
+}
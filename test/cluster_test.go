@@ -3,10 +3,12 @@ package test
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -38,7 +40,6 @@ func TestGenerateClusterTemplate(t *testing.T) {
 		FailureDomain:             "az-01", // nova/az-01
 		IgnoreVolumeAZ:            true,
 	}
-	cloudsYaml.SetEnvironment(opt)
 
 	infrastructure := "openstack"
 	capi, _ := api.NewClusterApiClient("", "./data/capi-management-cluster/capi-management-cluster.kubeconfig")
@@ -51,6 +52,10 @@ func TestGenerateClusterTemplate(t *testing.T) {
 	}
 
 	t.Log("Generate workload cluster YAML")
+	variables, err := cloudsYaml.TemplateVariables(opt)
+	if err != nil {
+		t.Fatal("Template variables error:", err)
+	}
 	clusterOpt := option.GenerateWorkloadClusterOptions{
 		ClusterName:              clusterName,
 		KubernetesVersion:        "v1.24.8",
@@ -59,6 +64,7 @@ func TestGenerateClusterTemplate(t *testing.T) {
 		InfrastructureProvider:   infrastructure,
 		Flavor:                   "",
 		URL:                      "./data/template-external-cloud-provider.yaml",
+		Variables:                variables,
 	}
 	yaml, err := capi.GenerateWorkloadClusterYaml(clusterOpt)
 	if err != nil {
@@ -70,6 +76,44 @@ func TestGenerateClusterTemplate(t *testing.T) {
 	}
 }
 
+// go test ./test -v -run ^TestGenerateClusterTemplateConcurrently$
+func TestGenerateClusterTemplateConcurrently(t *testing.T) {
+	capi, _ := api.NewClusterApiClient("", "./data/capi-management-cluster/capi-management-cluster.kubeconfig")
+
+	images := []string{"ubuntu-2204-kube-v1.24.8", "ubuntu-2204-kube-v1.25.16"}
+	yamls := make([]string, len(images))
+	errs := make([]error, len(images))
+	done := make(chan struct{})
+	for i, image := range images {
+		go func(i int, image string) {
+			defer func() { done <- struct{}{} }()
+			yamls[i], errs[i] = capi.GenerateWorkloadClusterYaml(option.GenerateWorkloadClusterOptions{
+				ClusterName:              fmt.Sprintf("capi-tenant-%d", i),
+				KubernetesVersion:        "v1.24.8",
+				WorkerMachineCount:       1,
+				ControlPlaneMachineCount: 1,
+				InfrastructureProvider:   "openstack",
+				URL:                      "./data/template-external-cloud-provider.yaml",
+				Variables: map[string]string{
+					"OPENSTACK_IMAGE_NAME": image,
+				},
+			})
+		}(i, image)
+	}
+	for range images {
+		<-done
+	}
+
+	for i, image := range images {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if !strings.Contains(yamls[i], image) {
+			t.Fatalf("cluster %d is missing image %s", i, image)
+		}
+	}
+}
+
 // go test ./test -v -run ^TestGetWorkloadClusterKubeconfig$
 func TestGetWorkloadClusterKubeconfig(t *testing.T) {
 	capi, _ := api.NewClusterApiClient("", "./data/local.kubeconfig")
@@ -173,9 +217,11 @@ func TestCreateSecret(t *testing.T) {
 		DnsNameServers:            "8.8.8.8",
 		FailureDomain:             "az-01", // nova/az-01
 	}
-	cloudsYaml.SetEnvironment(opt)
-
-	cloudConf := os.Getenv("OPENSTACK_CLOUD_PROVIDER_CONF")
+	variables, err := cloudsYaml.TemplateVariables(opt)
+	if err != nil {
+		t.Fatal("Error reading cloud conf:", err)
+	}
+	cloudConf := variables["OPENSTACK_CLOUD_PROVIDER_CONF"]
 	if cloudConf == "" {
 		t.Fatal("Error reading cloud conf: OPENSTACK_CLOUD_PROVIDER_CONF is not set")
 	}
@@ -265,6 +311,678 @@ func TestKubectlManifestWithLabelSelector(t *testing.T) {
 	})
 }
 
+// go test ./test -v -run ^TestServerSideApplyYaml$
+func TestServerSideApplyYaml(t *testing.T) {
+	capi, _ := api.NewClusterApiClient("", "./data/capi-helm-testing.kubeconfig")
+	yaml, err := model.ReadYamlFromUrl(option.FLANNEL_MANIFEST_URL)
+	if err != nil {
+		t.Fatal(error.Error(err))
+	}
+
+	results, err := capi.ServerSideApplyYaml(yaml, option.ServerSideApplyOptions{
+		FieldManager:   "cluster-api-go-sdk-test",
+		ForceConflicts: true,
+	})
+	if err != nil {
+		t.Fatal(error.Error(err))
+	}
+
+	for _, result := range results {
+		t.Log(result.Kind, result.Namespace, result.Name, result.Status, result.Message)
+	}
+}
+
+// go test ./test -v -run ^TestDryRunYaml$
+func TestDryRunYaml(t *testing.T) {
+	capi, _ := api.NewClusterApiClient("", "./data/capi-helm-testing.kubeconfig")
+	yaml, err := model.ReadYamlFromUrl(option.FLANNEL_MANIFEST_URL)
+	if err != nil {
+		t.Fatal(error.Error(err))
+	}
+
+	t.Run("dry run apply", func(t *testing.T) {
+		diffs, err := capi.DryRunApplyYaml(yaml, option.ServerSideApplyOptions{})
+		if err != nil {
+			t.Fatal(error.Error(err))
+		}
+		for _, diff := range diffs {
+			t.Log(diff.Kind, diff.Name, diff.Action)
+			t.Log(diff.Diff)
+		}
+	})
+
+	t.Run("dry run delete", func(t *testing.T) {
+		diffs, err := capi.DryRunDeleteYaml(yaml)
+		if err != nil {
+			t.Fatal(error.Error(err))
+		}
+		for _, diff := range diffs {
+			t.Log(diff.Kind, diff.Name, diff.Action, diff.Message)
+		}
+	})
+}
+
+// go test ./test -v -run ^TestWithContextCancellation$
+func TestWithContextCancellation(t *testing.T) {
+	capi, _ := api.NewClusterApiClient("", "./data/capi-helm-testing.kubeconfig")
+
+	t.Run("deadline exceeded", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_, err := capi.ExecuteNodeShellCommandWithContext(ctx, "capi-helm-testing-md-0", "sleep 60")
+		if err == nil {
+			t.Fatal("expected deadline exceeded error")
+		}
+		t.Log(err)
+	})
+
+	t.Run("cancelled before request", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, err := capi.GetPodLogsWithContext(ctx, "kube-system", "kube-apiserver"); err == nil {
+			t.Fatal("expected context canceled error")
+		}
+	})
+}
+
+// go test ./test -v -run ^TestNewClusterApiClientWithOptions$
+func TestNewClusterApiClientWithOptions(t *testing.T) {
+	t.Run("invalid kubeconfig", func(t *testing.T) {
+		_, err := api.NewClusterApiClientWithOptions(api.WithKubeconfigBytes([]byte("not a kubeconfig")))
+		if !errors.Is(err, api.ErrInvalidKubeconfig) {
+			t.Fatal("expected invalid kubeconfig error, got:", err)
+		}
+		t.Log(err)
+	})
+
+	t.Run("kubeconfig bytes", func(t *testing.T) {
+		b, err := os.ReadFile("./data/local.kubeconfig")
+		if err != nil {
+			t.Fatal(err)
+		}
+		capi, err := api.NewClusterApiClientWithOptions(
+			api.WithKubeconfigBytes(b),
+			api.WithRateLimit(100, 50),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Log(capi.Config.Host)
+	})
+
+	t.Run("rest config", func(t *testing.T) {
+		capi, _ := api.NewClusterApiClient("", "./data/local.kubeconfig")
+		cl, err := api.NewClusterApiClientWithOptions(api.WithRestConfig(capi.Config))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Log(cl.Config.Host)
+	})
+}
+
+// go test ./test -v -run ^TestWaitForClusterReady$
+func TestWaitForClusterReady(t *testing.T) {
+	capi, _ := api.NewClusterApiClient("", "./data/capi-management-cluster/capi-management-cluster.kubeconfig")
+
+	err := capi.WaitForClusterReady(context.Background(), "capi-elitery", "default", api.WaitForClusterReadyOptions{
+		Timeout:      20 * time.Minute,
+		PollInterval: 15 * time.Second,
+		OnProgress: func(event model.ClusterProgressEvent) {
+			t.Log(event.Status.Kind, event.Status.Name, event.Status.Phase,
+				event.Status.ReadyReplicas, "/", event.Status.Replicas, event.Status.Reason)
+		},
+	})
+
+	var notReady *api.ClusterNotReadyError
+	if errors.As(err, &notReady) {
+		t.Fatal("cluster is not ready:", notReady.Kind, notReady.Name, notReady.ConditionType, notReady.Reason)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// go test ./test -v -run ^TestTypedClusterApiObjects$
+func TestTypedClusterApiObjects(t *testing.T) {
+	capi, _ := api.NewClusterApiClient("", "./data/capi-management-cluster/capi-management-cluster.kubeconfig")
+	ctx := context.Background()
+	clusterName := "capi-elitery"
+	namespace := "default"
+
+	t.Run("get cluster", func(t *testing.T) {
+		cluster, err := capi.GetCluster(ctx, clusterName, namespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Log(cluster.Status.Phase, cluster.Spec.ControlPlaneEndpoint.Host)
+	})
+
+	t.Run("list machines", func(t *testing.T) {
+		machines, err := capi.ListMachines(ctx, namespace, api.ClusterLabelSelector(clusterName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, machine := range machines.Items {
+			t.Log(machine.Name, machine.Status.Phase, *machine.Spec.Version)
+			if machine.Status.NodeRef != nil {
+				t.Log(machine.Status.NodeRef.Name)
+			}
+			if machine.Status.FailureMessage != nil {
+				t.Log(*machine.Status.FailureMessage)
+			}
+		}
+	})
+
+	t.Run("list machine deployments", func(t *testing.T) {
+		mds, err := capi.ListMachineDeployments(ctx, namespace, api.ClusterLabelSelector(clusterName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, md := range mds.Items {
+			t.Log(md.Name, md.Status.Phase, md.Status.ReadyReplicas)
+		}
+	})
+
+	t.Run("list kubeadm control planes", func(t *testing.T) {
+		kcps, err := capi.ListKubeadmControlPlanes(ctx, namespace, api.ClusterLabelSelector(clusterName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, kcp := range kcps.Items {
+			t.Log(kcp.Name, kcp.Spec.Version, kcp.Status.ReadyReplicas)
+		}
+	})
+}
+
+// go test ./test -v -run ^TestScaleWorkloadCluster$
+func TestScaleWorkloadCluster(t *testing.T) {
+	capi, _ := api.NewClusterApiClient("", "./data/capi-management-cluster/capi-management-cluster.kubeconfig")
+	ctx := context.Background()
+	namespace := "default"
+
+	t.Run("scale machine deployment", func(t *testing.T) {
+		err := capi.ScaleMachineDeployment(ctx, "capi-elitery-md-0", namespace, 2, api.ScaleOptions{
+			Wait:    true,
+			Timeout: 20 * time.Minute,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("even control plane replicas", func(t *testing.T) {
+		err := capi.ScaleControlPlane(ctx, "capi-elitery-control-plane", namespace, 2, api.ScaleOptions{})
+		if !errors.Is(err, api.ErrInvalidReplicas) {
+			t.Fatal("expected invalid replicas error, got:", err)
+		}
+	})
+
+	t.Run("scale control plane", func(t *testing.T) {
+		err := capi.ScaleControlPlane(ctx, "capi-elitery-control-plane", namespace, 3, api.ScaleOptions{
+			Wait:    true,
+			Timeout: 30 * time.Minute,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// go test ./test -v -run ^TestUpgradeCluster$
+func TestUpgradeCluster(t *testing.T) {
+	capi, _ := api.NewClusterApiClient("", "./data/capi-management-cluster/capi-management-cluster.kubeconfig")
+	ctx := context.Background()
+	planFile := "./data/capi-elitery-upgrade-plan.json"
+
+	plan := &model.UpgradePlan{}
+	if b, err := os.ReadFile(planFile); err == nil {
+		t.Log("resume upgrade plan")
+		if err := json.Unmarshal(b, plan); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		plan, err = capi.PlanClusterUpgrade(ctx, "capi-elitery", "default", option.UpgradeClusterOptions{
+			KubernetesVersion: "v1.25.16",
+			ControlPlaneImage: "ubuntu-2204-kube-v1.25.16",
+			WorkerImage:       "ubuntu-2204-kube-v1.25.16",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := capi.UpgradeCluster(ctx, plan, option.UpgradeOptions{}, func(plan model.UpgradePlan) {
+		b, _ := json.Marshal(plan)
+		os.WriteFile(planFile, b, 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// go test ./test -v -run ^TestDeleteClusterAndWait$
+func TestDeleteClusterAndWait(t *testing.T) {
+	capi, _ := api.NewClusterApiClient("", "./data/capi-management-cluster/capi-management-cluster.kubeconfig")
+
+	report, err := capi.DeleteClusterAndWait(context.Background(), "capi-elitery", "default", api.DeleteClusterOptions{
+		OnProgress: func(report model.ClusterDeletionReport) {
+			for _, obj := range report.StuckObjects {
+				t.Log(obj.Kind, obj.Name, obj.Finalizers, obj.Reason, obj.Message)
+			}
+		},
+	})
+	t.Log("deleted services:", report.WorkloadCleanup.DeletedServices)
+	t.Log("deleted pvcs:", report.WorkloadCleanup.DeletedPersistentVolumeClaims)
+	t.Log("pvcs in use:", report.WorkloadCleanup.InUsePersistentVolumeClaims)
+	t.Log("cleanup errors:", report.WorkloadCleanup.Errors)
+	if errors.Is(err, api.ErrClusterDeletion) {
+		t.Fatal("stuck objects:", report.StuckObjects)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// go test ./test -v -run ^TestDescribeClusterReport$
+func TestDescribeClusterReport(t *testing.T) {
+	capi, _ := api.NewClusterApiClient("", "./data/capi-management-cluster/capi-management-cluster.kubeconfig")
+
+	report, err := capi.DescribeClusterReport(context.Background(), "capi-elitery", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := json.MarshalIndent(report.Tree, "", "  ")
+	t.Log(string(b))
+	for _, obj := range report.Unhealthy {
+		t.Log(strings.Join(obj.Path, " > "), obj.Severity, obj.Reason, obj.Message)
+	}
+}
+
+// go test ./test -v -run ^TestMoveCluster$
+func TestMoveCluster(t *testing.T) {
+	capi, _ := api.NewClusterApiClient("", "./data/capi-management-cluster/capi-management-cluster.kubeconfig")
+	ctx := context.Background()
+
+	t.Run("dry run", func(t *testing.T) {
+		err := capi.MoveCluster(ctx, api.MoveClusterOptions{
+			ToKubeconfigFile: "./data/capi-elitery.kubeconfig",
+			Namespace:        "default",
+			DryRun:           true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("backup to directory", func(t *testing.T) {
+		dir := t.TempDir()
+		err := capi.MoveCluster(ctx, api.MoveClusterOptions{
+			Namespace:   "default",
+			ToDirectory: dir,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files, _ := os.ReadDir(dir)
+		t.Log("saved objects:", len(files))
+
+		// without a target the directory is restored into this management cluster, which
+		// resumes the clusters paused by the backup
+		err = capi.MoveCluster(ctx, api.MoveClusterOptions{
+			Namespace:     "default",
+			FromDirectory: dir,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		clusters, err := capi.ListClusters(ctx, "default", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, cluster := range clusters.Items {
+			if cluster.Spec.Paused {
+				t.Fatal("cluster not restored into this management cluster:", cluster.Name)
+			}
+		}
+	})
+
+	t.Run("pivot", func(t *testing.T) {
+		err := capi.Pivot(ctx, "capi-elitery", "default", api.PivotOptions{
+			InitProviders: true,
+		})
+		if errors.Is(err, api.ErrMoveTargetNotReady) {
+			t.Fatal("target not ready:", err)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// go test ./test -v -run ^TestProviderUpgrade$
+func TestProviderUpgrade(t *testing.T) {
+	capi, _ := api.NewClusterApiClient("", "./data/capi-management-cluster/capi-management-cluster.kubeconfig")
+	ctx := context.Background()
+
+	providers, err := capi.ListInstalledProviders(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, provider := range providers {
+		t.Log(provider.Type, provider.Name, provider.Namespace, provider.CurrentVersion)
+	}
+
+	plans, err := capi.PlanUpgrade(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plan := range plans {
+		for _, provider := range plan.Providers {
+			t.Log(plan.Contract, provider.Name, provider.CurrentVersion, "->", provider.AvailableVersion)
+		}
+	}
+
+	if len(plans) > 0 {
+		err := capi.ApplyUpgrade(ctx, api.ProviderUpgradeOptions{
+			Contract:      plans[len(plans)-1].Contract,
+			WaitProviders: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("default contract", func(t *testing.T) {
+		// without providers every provider is upgraded within the contract of clusterctl
+		if err := capi.ApplyUpgrade(ctx, api.ProviderUpgradeOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// go test ./test -v -run ^TestWaitForProviders$
+func TestWaitForProviders(t *testing.T) {
+	capi, _ := api.NewClusterApiClient("", "./data/capi-management-cluster/capi-management-cluster.kubeconfig")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	statuses, err := capi.WaitForProviders(ctx, "cluster-api", "bootstrap-kubeadm", "control-plane-kubeadm", "openstack")
+	for _, status := range statuses {
+		t.Log(status.Type, status.Name, status.Namespace, status.Available, status.Message)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// go test ./test -v -run ^TestInitInfrastructureWithOptions$
+func TestInitInfrastructureWithOptions(t *testing.T) {
+	capi, _ := api.NewClusterApiClient("", "./data/capi-management-cluster/capi-management-cluster.kubeconfig")
+
+	components, err := capi.InitInfrastructureWithOptions(context.Background(), option.InitInfrastructureOptions{
+		CoreProvider:            option.InitProvider{Name: "cluster-api", Version: "v1.9.9"},
+		BootstrapProviders:      []option.InitProvider{{Name: "k0sproject-k0smotron"}},
+		ControlPlaneProviders:   []option.InitProvider{{Name: "k0sproject-k0smotron"}},
+		InfrastructureProviders: []option.InitProvider{{Name: "openstack", Version: "v0.12.4"}},
+		WaitProviders:           true,
+		WaitProviderTimeout:     10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, component := range components {
+		t.Log(component.Type(), component.Name(), component.Version(), component.TargetNamespace())
+	}
+}
+
+// go test ./test -v -run ^TestValidateTemplateVariables$
+func TestValidateTemplateVariables(t *testing.T) {
+	capi, _ := api.NewClusterApiClient("", "./data/capi-management-cluster/capi-management-cluster.kubeconfig")
+
+	opt := option.GenerateWorkloadClusterOptions{
+		ClusterName:            "capi-tenant",
+		KubernetesVersion:      "v1.24.8",
+		InfrastructureProvider: "openstack",
+		URL:                    "./data/template-external-cloud-provider.yaml",
+		Variables: map[string]string{
+			"OPENSTACK_IMAGE_NAME": "ubuntu-2204-kube-v1.24.8",
+			"UNKNOWN_VARIABLE":     "value",
+		},
+	}
+
+	variables, err := capi.ListTemplateVariables(context.Background(), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, variable := range variables {
+		fmt.Println(variable.Name, variable.Required)
+	}
+
+	validation, err := capi.ValidateTemplateVariables(context.Background(), opt)
+	if !errors.Is(err, api.ErrMissingTemplateVariables) {
+		t.Fatal("expected missing template variables, got:", err)
+	}
+	if len(validation.Unused) != 1 || validation.Unused[0] != "UNKNOWN_VARIABLE" {
+		t.Fatal("unexpected unused variables:", validation.Unused)
+	}
+	fmt.Println("missing:", validation.Missing)
+}
+
+// go test ./test -v -run ^TestGenerateTopologyCluster$
+func TestGenerateTopologyCluster(t *testing.T) {
+	capi, _ := api.NewClusterApiClient("", "./data/capi-management-cluster/capi-management-cluster.kubeconfig")
+
+	yaml, err := capi.GenerateTopologyCluster(context.Background(), option.GenerateTopologyClusterOptions{
+		ClusterName:          "capi-topology",
+		ClusterClass:         "quick-start",
+		KubernetesVersion:    "v1.31.0",
+		ControlPlaneReplicas: 1,
+		MachineDeployments: []option.TopologyMachineDeployment{
+			{Name: "md-0", Class: "default-worker", Replicas: 2},
+		},
+		PodCidrBlocks: []string{"192.168.0.0/16"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(yaml)
+
+	if err := capi.ApplyYaml(yaml); err != nil {
+		t.Fatal(err)
+	}
+
+	replicas := int32(3)
+	cluster, err := capi.PatchClusterTopology(context.Background(), "capi-topology", "default", option.PatchTopologyOptions{
+		ControlPlaneReplicas:      &replicas,
+		MachineDeploymentReplicas: map[string]int32{"md-0": 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *cluster.Spec.Topology.ControlPlane.Replicas != replicas {
+		t.Fatal("control plane replicas weren't patched")
+	}
+}
+
+// go test ./test -v -run ^TestGenerateOpenstackClusterTemplate$
+func TestGenerateOpenstackClusterTemplate(t *testing.T) {
+	yamlByte, _ := os.ReadFile("./data/servercore/clouds-ke-1.yaml")
+	capi, _ := api.NewClusterApiClient("", "./data/capi-management-cluster/capi-management-cluster.kubeconfig")
+
+	clusterName := "capi-elitery"
+	yaml, cloudConf, err := capi.GenerateOpenstackWorkloadClusterYaml(option.GenerateOpenstackWorkloadClusterOption{
+		ClusterName:              clusterName,
+		KubernetesVersion:        "v1.24.8",
+		WorkerMachineCount:       1,
+		ControlPlaneMachineCount: 1,
+		URL:                      "./data/template-external-cloud-provider.yaml",
+		CloudsYaml:               yamlByte,
+		OpenstackGenerateClusterOptions: option.OpenstackGenerateClusterOptions{
+			ControlPlaneMachineFlavor: "a2.medium-1",
+			NodeMachineFlavor:         "a2.large-2",
+			ExternalNetworkId:         "f30c9e3d-757b-43fb-b4e0-da3ab36708a4",
+			ImageName:                 "Ubuntu-22.04-eranyaImage-v1.0",
+			SshKeyName:                "eranya-ssh",
+			DnsNameServers:            "213.148.0.221,213.148.0.222",
+			FailureDomain:             "az-01",
+			IgnoreVolumeAZ:            true,
+		},
+		ManagedSubnets: []option.ManagedSubnet{
+			{Cidr: "10.6.0.0/24", DnsNameServers: []string{"213.148.0.221", "213.148.0.222"}},
+		},
+	})
+	if err != nil {
+		t.Fatal("Generate workload cluster error:", err)
+	}
+	if os.Getenv("CAPO_AUTH_URL") != "" {
+		t.Fatal("environment must not be modified")
+	}
+	if !strings.Contains(cloudConf, "ignore-volume-az=true") {
+		t.Fatal("cloud.conf is missing the block storage section:", cloudConf)
+	}
+
+	if err := os.WriteFile(fmt.Sprintf("./data/%s.yaml", clusterName), []byte(yaml), 0644); err != nil {
+		t.Fatal("Write yaml error:", err)
+	}
+}
+
+// go test ./test -v -run ^TestClusterctlFromKubeconfigBytes$
+func TestClusterctlFromKubeconfigBytes(t *testing.T) {
+	b, err := os.ReadFile("./data/capi-management-cluster/capi-management-cluster.kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	capi, err := api.NewClusterApiClientWithOptions(
+		api.WithKubeconfigBytes(b),
+		api.WithKubeconfigContext(""),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	plans, err := capi.PlanUpgrade(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plan := range plans {
+		t.Log(plan.Contract, len(plan.Providers))
+	}
+
+	report, err := capi.DescribeClusterReport(ctx, "capi-elitery", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(len(report.Unhealthy))
+
+	target, err := os.ReadFile("./data/capi-elitery.kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = capi.MoveCluster(ctx, api.MoveClusterOptions{
+		ToKubeconfigBytes: target,
+		Namespace:         "default",
+		DryRun:            true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// go test ./test -v -run ^TestWorkloadClient$
+func TestWorkloadClient(t *testing.T) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	capi, err := api.NewClusterApiClientWithOptions(
+		api.WithKubeconfigFile("./data/capi-management-cluster/capi-management-cluster.kubeconfig"),
+		api.WithWorkloadDialer(dialer.DialContext),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	workload, helmClient, err := capi.WorkloadClient(ctx, "capi-elitery", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes, err := workload.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("nodes:", len(nodes.Items))
+
+	cached, cachedHelm, err := capi.WorkloadClient(ctx, "capi-elitery", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached != workload || cachedHelm != helmClient {
+		t.Fatal("expected the cached clients")
+	}
+}
+
+// go test ./test -v -run ^TestApplyYamlInOrder$
+func TestApplyYamlInOrder(t *testing.T) {
+	capi, _ := api.NewClusterApiClient("", "./data/capi-helm-testing.kubeconfig")
+
+	// the custom resource and the namespaced object come before their CRD and namespace
+	manifest := `apiVersion: example.lyrid.io/v1
+kind: Widget
+metadata:
+  name: widget-sample
+  namespace: apply-order-test
+spec:
+  size: 1
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: widget-config
+  namespace: apply-order-test
+data:
+  size: "1"
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.lyrid.io
+spec:
+  group: example.lyrid.io
+  names:
+    kind: Widget
+    plural: widgets
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        x-kubernetes-preserve-unknown-fields: true
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: apply-order-test
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+	if err := capi.ApplyYamlWithContext(ctx, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if err := capi.DeleteYaml(manifest); err != nil {
+			t.Log(err)
+		}
+	})
+}
+
 // go test ./test -v -run ^TestGetKubeconfigValues$
 func TestGetKubeconfigValues(t *testing.T) {
 	t.Run("has ca data", func(t *testing.T) {
@@ -254,9 +254,11 @@ func TestUpdateYamlManifest(t *testing.T) {
 			FailureDomain:             "az-01", // nova/az-01
 			IgnoreVolumeAZ:            true,
 		}
-		cloudsYaml.SetEnvironment(opt)
-
-		cloudConf := os.Getenv("OPENSTACK_CLOUD_PROVIDER_CONF_B64")
+		variables, err := cloudsYaml.TemplateVariables(opt)
+		if err != nil {
+			t.Fatal("Error reading cloud conf:", err)
+		}
+		cloudConf := variables["OPENSTACK_CLOUD_PROVIDER_CONF_B64"]
 		if cloudConf == "" {
 			t.Fatal("Error reading cloud conf: OPENSTACK_CLOUD_PROVIDER_CONF_B64 is not set")
 		}
@@ -940,7 +942,7 @@ func TestFlavorList(t *testing.T) {
 	yamlByte, _ := os.ReadFile("./data/elitery-clouds.yaml")
 	cloudsYaml := model.CloudsYaml{}
 	cloudsYaml.Parse(yamlByte)
-	auth := cloudsYaml.Clouds.Openstack.Auth
+	auth := cloudsYaml.Clouds["openstack"].Auth
 
 	cl := api.OpenstackClient{
 		MagnumEndpoint:  auth.MagnumUrl,
@@ -0,0 +1,51 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/LyridInc/cluster-api-go-sdk/api"
+	"github.com/LyridInc/cluster-api-go-sdk/option"
+)
+
+// go test ./test -v -run ^TestGenerateVSphereClusterTemplate$
+func TestGenerateVSphereClusterTemplate(t *testing.T) {
+	infrastructure := "vsphere"
+	capi, _ := api.NewClusterApiClient("", "./data/capi-management-cluster/capi-management-cluster.kubeconfig")
+
+	clusterName := "capv-tenant"
+	ready, err := capi.InfrastructureReadiness(infrastructure)
+	if !ready && err == nil {
+		t.Log("initialize infrastructure")
+		capi.InitInfrastructure(infrastructure)
+	}
+
+	t.Log("Generate workload cluster YAML")
+	clusterOpt := option.GenerateVSphereWorkloadClusterOption{
+		ClusterName:              clusterName,
+		Namespace:                "default",
+		KubernetesVersion:        "v1.30.11",
+		WorkerMachineCount:       2,
+		ControlPlaneMachineCount: 1,
+		Server:                   os.Getenv("VSPHERE_SERVER"),
+		Username:                 os.Getenv("VSPHERE_USERNAME"),
+		Password:                 os.Getenv("VSPHERE_PASSWORD"),
+		TlsThumbprint:            os.Getenv("VSPHERE_TLS_THUMBPRINT"),
+		Datacenter:               "SDDC-Datacenter",
+		Datastore:                "WorkloadDatastore",
+		Network:                  "VM Network",
+		ResourcePool:             "*/Resources",
+		Folder:                   "capv",
+		Template:                 "ubuntu-2204-kube-v1.30.11",
+		ControlPlaneEndpointIP:   "10.0.0.10",
+	}
+	yaml, err := capi.GenerateVSphereWorkloadClusterYaml(clusterOpt)
+	if err != nil {
+		t.Fatal("Generate workload cluster error:", err)
+	}
+
+	if err := os.WriteFile(fmt.Sprintf("./data/%s.yaml", clusterName), []byte(yaml), 0644); err != nil {
+		t.Fatal("Write yaml error:", err)
+	}
+}
@@ -2,6 +2,7 @@ package test
 
 import (
 	"archive/zip"
+	"encoding/base64"
 	"io"
 	"os"
 	"path/filepath"
@@ -11,6 +12,7 @@ import (
 	"github.com/LyridInc/cluster-api-go-sdk/api"
 	"github.com/LyridInc/cluster-api-go-sdk/model"
 	"github.com/LyridInc/cluster-api-go-sdk/option"
+	"github.com/LyridInc/cluster-api-go-sdk/utils"
 )
 
 // go test ./test -v -run ^TestReadYamlFromUrl$
@@ -39,17 +41,13 @@ func TestCloudsYaml(t *testing.T) {
 		FailureDomain:             "az-01", // nova/az-01
 		IgnoreVolumeAZ:            true,
 	}
-	cloudsYaml.SetEnvironment(opt)
-
-	envs := os.Environ()
-	filteredEnvs := []string{}
-	for _, env := range envs {
-		if strings.HasPrefix(env, "OPENSTACK") || strings.HasPrefix(env, "CAPO") {
-			filteredEnvs = append(filteredEnvs, env)
-		}
+	variables, err := cloudsYaml.TemplateVariables(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range variables {
+		t.Log(key, "=", value)
 	}
-
-	t.Log(filteredEnvs)
 }
 
 // go test ./test -v -run ^TestUpdateYaml$
@@ -110,6 +108,170 @@ func TestUpdateChartYaml(t *testing.T) {
 	defer os.RemoveAll("./data/zipped")
 }
 
+// go test ./test -v -run ^TestPatchYamlManifest$
+func TestPatchYamlManifest(t *testing.T) {
+	manifest := `apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: csi-cinder-nodeplugin
+  labels:
+    app: csi-cinder-nodeplugin
+spec:
+  template:
+    spec:
+      containers:
+      - name: cinder-csi-plugin
+        image: registry.k8s.io/provider-os/cinder-csi-plugin:v1.31.0
+      - name: liveness-probe
+        image: registry.k8s.io/sig-storage/livenessprobe:v2.13.1
+      volumes:
+      - name: secret-cinderplugin
+        secret:
+          secretName: cloud-config
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: cloud-config
+  namespace: kube-system
+data:
+  cloud.conf: ""
+`
+
+	yamlResult, err := utils.PatchYamlManifest(manifest, []option.ManifestPatch{
+		{
+			Target: option.ManifestPatchTarget{Kind: "DaemonSet", LabelSelector: "app=csi-cinder-nodeplugin"},
+			Type:   option.ManifestPatchStrategicMerge,
+			Patch: `spec:
+  template:
+    spec:
+      containers:
+      - name: cinder-csi-plugin
+        image: registry.k8s.io/provider-os/cinder-csi-plugin:v1.32.0`,
+		},
+		{
+			Target: option.ManifestPatchTarget{Kind: "DaemonSet"},
+			Type:   option.ManifestPatchJSONPathSet,
+			Path:   `{.spec.template.spec.volumes[?(@.name=="secret-cinderplugin")].secret.secretName}`,
+			Value:  "capi-local-csi-secret",
+		},
+		{
+			Target: option.ManifestPatchTarget{Kind: "Secret", Name: "cloud-config"},
+			Type:   option.ManifestPatchJSON6902,
+			Patch: `- op: replace
+  path: /metadata/name
+  value: capi-local-csi-secret`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"cinder-csi-plugin:v1.32.0", "livenessprobe:v2.13.1", "secretName: capi-local-csi-secret", "name: capi-local-csi-secret"} {
+		if !strings.Contains(yamlResult, expected) {
+			t.Fatal("patched manifest is missing", expected, yamlResult)
+		}
+	}
+	t.Log(yamlResult)
+}
+
+// go test ./test -v -run ^TestRenderKustomization$
+func TestRenderKustomization(t *testing.T) {
+	base, err := model.ReadYamlFromUrl(option.FLANNEL_MANIFEST_URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	yamlResult, err := utils.RenderKustomization(base, map[string]string{
+		"kustomization.yaml": `resources:
+- ../base
+labels:
+- pairs:
+    cloud: openstack
+patches:
+- path: net-conf.yaml`,
+		"net-conf.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: kube-flannel-cfg
+  namespace: kube-flannel
+data:
+  net-conf.json: |
+    {"Network": "10.244.0.0/16", "Backend": {"Type": "vxlan"}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(yamlResult, "cloud: openstack") {
+		t.Fatal("overlay labels are missing:", yamlResult)
+	}
+	t.Log(yamlResult)
+
+	if _, err := utils.RenderKustomization(base, map[string]string{"net-conf.yaml": ""}); err == nil {
+		t.Fatal("expected an error for an overlay without kustomization.yaml")
+	}
+}
+
+// go test ./test -v -run ^TestMultiCloudsYaml$
+func TestMultiCloudsYaml(t *testing.T) {
+	cloudsByte := []byte(`clouds:
+  tenant-a:
+    auth:
+      auth_url: https://keystone-a.example.com/v3
+      username: tenant-a
+  tenant-b:
+    auth:
+      auth_url: https://keystone-b.example.com/v3
+      username: tenant-b
+`)
+	secureByte := []byte(`clouds:
+  tenant-b:
+    auth:
+      password: secret-b
+`)
+
+	cloudsYaml := model.CloudsYaml{}
+	if err := cloudsYaml.Parse(cloudsByte); err != nil {
+		t.Fatal(err)
+	}
+	if err := cloudsYaml.MergeSecure(secureByte); err != nil {
+		t.Fatal(err)
+	}
+	if err := cloudsYaml.SelectCloud("tenant-b"); err != nil {
+		t.Fatal(err)
+	}
+
+	variables, err := cloudsYaml.TemplateVariables(option.OpenstackGenerateClusterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if variables["OPENSTACK_CLOUD"] != "tenant-b" || variables["CAPO_PASSWORD"] != "secret-b" {
+		t.Fatal("unexpected variables:", variables["OPENSTACK_CLOUD"], variables["CAPO_PASSWORD"])
+	}
+	cloudYaml, err := base64.StdEncoding.DecodeString(variables["OPENSTACK_CLOUD_YAML_B64"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(cloudYaml), "tenant-a") || !strings.Contains(string(cloudYaml), "secret-b") {
+		t.Fatal("OPENSTACK_CLOUD_YAML_B64 must only have the selected cloud:", string(cloudYaml))
+	}
+	if cloudsYaml.Clouds["tenant-b"].Auth.AuthUrl != "https://keystone-b.example.com/v3" {
+		t.Fatal("secure.yaml must not replace the clouds.yaml values")
+	}
+	if err := cloudsYaml.SelectCloud("tenant-c"); err == nil {
+		t.Fatal("expected an error for an unknown cloud")
+	}
+
+	// without a selection and an "openstack" cloud, the cloud to use is unknown
+	cloudsYaml = model.CloudsYaml{}
+	if err := cloudsYaml.Parse(cloudsByte); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cloudsYaml.TemplateVariables(option.OpenstackGenerateClusterOptions{}); err == nil {
+		t.Fatal("expected an error without a selected cloud")
+	}
+}
+
 // go test ./test -v -run ^TestAnotherCloudsYaml$
 func TestAnotherCloudsYaml(t *testing.T) {
 	yamlByte, _ := os.ReadFile("./data/elitery-clouds.yaml")
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+const (
+	kustomizationBaseDir     = "/base"
+	kustomizationOverlayDir  = "/overlay"
+	kustomizationBaseFile    = "manifest.yaml"
+	kustomizationBaseContent = "resources:\n- " + kustomizationBaseFile + "\n"
+)
+
+// RenderKustomization renders overlay on top of the base manifest and returns the YAML of the
+// resources, e.g. to pass to ApplyYaml. Overlay maps file paths, relative to the overlay
+// directory, to their content and must have a kustomization.yaml that lists "../base" in its
+// resources. Both are kept in an in-memory filesystem.
+func RenderKustomization(base string, overlay map[string]string) (string, error) {
+	fs := filesys.MakeFsInMemory()
+	if err := writeKustomizationFile(fs, kustomizationBaseDir, kustomizationBaseFile, base); err != nil {
+		return "", err
+	}
+	if err := writeKustomizationFile(fs, kustomizationBaseDir, konfig.DefaultKustomizationFileName(), kustomizationBaseContent); err != nil {
+		return "", err
+	}
+
+	hasKustomization := false
+	for name, content := range overlay {
+		for _, kustomizationName := range konfig.RecognizedKustomizationFileNames() {
+			if path.Clean(name) == kustomizationName {
+				hasKustomization = true
+			}
+		}
+		if err := writeKustomizationFile(fs, kustomizationOverlayDir, name, content); err != nil {
+			return "", err
+		}
+	}
+	if !hasKustomization {
+		return "", fmt.Errorf("overlay has no %s", konfig.DefaultKustomizationFileName())
+	}
+
+	resources, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(fs, kustomizationOverlayDir)
+	if err != nil {
+		return "", err
+	}
+	yamlResult, err := resources.AsYaml()
+	if err != nil {
+		return "", err
+	}
+
+	return string(yamlResult), nil
+}
+
+// writeKustomizationFile writes a file of the base or the overlay, names can't leave the directory.
+func writeKustomizationFile(fs filesys.FileSystem, dir, name, content string) error {
+	name = path.Clean(name)
+	if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return fmt.Errorf("invalid kustomization file path %s", name)
+	}
+
+	filePath := path.Join(dir, name)
+	if err := fs.MkdirAll(path.Dir(filePath)); err != nil {
+		return err
+	}
+	return fs.WriteFile(filePath, []byte(content))
+}
@@ -0,0 +1,350 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/LyridInc/cluster-api-go-sdk/option"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// PatchYamlManifest applies the patches in order to every object of a multi-document manifest
+// they select.
+func PatchYamlManifest(yamlString string, patches []option.ManifestPatch) (string, error) {
+	return mapYamlManifest(yamlString, func(unstructuredObj *unstructured.Unstructured) error {
+		return PatchUnstructuredObject(unstructuredObj, patches)
+	})
+}
+
+// mapYamlManifest calls update on every object of a multi-document manifest and returns the
+// updated manifest.
+func mapYamlManifest(yamlString string, update func(*unstructured.Unstructured) error) (string, error) {
+	var (
+		err        error
+		yamlResult string
+	)
+	decoder := yamlutil.NewYAMLOrJSONDecoder(bytes.NewReader([]byte(yamlString)), 100)
+	for {
+		var rawObj runtime.RawExtension
+		if err = decoder.Decode(&rawObj); err != nil {
+			break
+		}
+		if len(bytes.TrimSpace(rawObj.Raw)) == 0 || bytes.Equal(bytes.TrimSpace(rawObj.Raw), []byte("null")) {
+			continue
+		}
+
+		unstructuredObj := &unstructured.Unstructured{}
+		if err := unstructuredObj.UnmarshalJSON(rawObj.Raw); err != nil {
+			return "", err
+		}
+		if err := update(unstructuredObj); err != nil {
+			return "", err
+		}
+
+		x, _ := yaml.Marshal(unstructuredObj.Object)
+		yamlResult = yamlResult + "---\n" + string(x)
+	}
+
+	if err != io.EOF {
+		return "", err
+	}
+
+	return yamlResult, nil
+}
+
+// PatchUnstructuredObject applies the patches that select the object in order.
+func PatchUnstructuredObject(unstructuredObj *unstructured.Unstructured, patches []option.ManifestPatch) error {
+	for i, patch := range patches {
+		selected, err := patchSelects(patch.Target, unstructuredObj)
+		if err != nil {
+			return fmt.Errorf("patch %d: %w", i, err)
+		}
+		if !selected {
+			continue
+		}
+
+		switch patch.Type {
+		case option.ManifestPatchStrategicMerge:
+			err = strategicMergePatch(unstructuredObj, patch.Patch)
+		case option.ManifestPatchJSON6902:
+			err = json6902Patch(unstructuredObj, patch.Patch)
+		case option.ManifestPatchJSONPathSet:
+			err = jsonPathSetPatch(unstructuredObj, patch.Path, patch.Value)
+		default:
+			err = fmt.Errorf("unknown patch type %q", patch.Type)
+		}
+		if err != nil {
+			return fmt.Errorf("patch %d on %s %s: %w", i, unstructuredObj.GetKind(), unstructuredObj.GetName(), err)
+		}
+	}
+
+	return nil
+}
+
+func patchSelects(target option.ManifestPatchTarget, obj *unstructured.Unstructured) (bool, error) {
+	gvk := obj.GroupVersionKind()
+	if target.Group != "" && target.Group != gvk.Group {
+		return false, nil
+	}
+	if target.Version != "" && target.Version != gvk.Version {
+		return false, nil
+	}
+	if target.Kind != "" && target.Kind != gvk.Kind {
+		return false, nil
+	}
+	if target.Name != "" && target.Name != obj.GetName() {
+		return false, nil
+	}
+	if target.Namespace != "" && target.Namespace != obj.GetNamespace() {
+		return false, nil
+	}
+	if target.LabelSelector != "" {
+		selector, err := labels.Parse(target.LabelSelector)
+		if err != nil {
+			return false, err
+		}
+		if !selector.Matches(labels.Set(obj.GetLabels())) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func strategicMergePatch(obj *unstructured.Unstructured, patch string) error {
+	patchJson, err := sigsyaml.YAMLToJSON([]byte(patch))
+	if err != nil {
+		return err
+	}
+	original, err := obj.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	var patched []byte
+	typed, err := scheme.Scheme.New(obj.GroupVersionKind())
+	if err == nil {
+		patched, err = strategicpatch.StrategicMergePatch(original, patchJson, typed)
+	} else {
+		// kinds unknown to client-go have no patch strategy, like kubectl use a JSON merge patch
+		patched, err = jsonpatch.MergePatch(original, patchJson)
+	}
+	if err != nil {
+		return err
+	}
+
+	return obj.UnmarshalJSON(patched)
+}
+
+func json6902Patch(obj *unstructured.Unstructured, patch string) error {
+	patchJson, err := sigsyaml.YAMLToJSON([]byte(patch))
+	if err != nil {
+		return err
+	}
+	operations, err := jsonpatch.DecodePatch(patchJson)
+	if err != nil {
+		return err
+	}
+	original, err := obj.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	patched, err := operations.Apply(original)
+	if err != nil {
+		return err
+	}
+
+	return obj.UnmarshalJSON(patched)
+}
+
+func jsonPathSetPatch(obj *unstructured.Unstructured, path string, value interface{}) error {
+	segments, err := parseJSONPath(path)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		return fmt.Errorf("empty path")
+	}
+
+	// the value is set as JSON, e.g. a struct with json tags becomes a map
+	valueJson, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	var jsonValue interface{}
+	if err := json.Unmarshal(valueJson, &jsonValue); err != nil {
+		return err
+	}
+
+	result, err := setJSONPath(obj.Object, segments, jsonValue)
+	if err != nil {
+		return err
+	}
+	resultJson, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	return obj.UnmarshalJSON(resultJson)
+}
+
+type jsonPathSegment struct {
+	field string
+	index *int
+	all   bool
+	// filter matches the list items whose filterPath equals filterValue
+	filter      bool
+	filterPath  []string
+	filterValue string
+}
+
+// parseJSONPath parses the subset of JSONPath used to select fields of a manifest: fields,
+// quoted fields, list indexes, [*] and [?(@.field=="value")] filters, e.g.
+// {.spec.template.spec.volumes[?(@.name=="cloud-config")].secret.secretName}.
+func parseJSONPath(path string) ([]jsonPathSegment, error) {
+	path = strings.TrimSpace(path)
+	path = strings.TrimSuffix(strings.TrimPrefix(path, "{"), "}")
+	path = strings.TrimPrefix(path, "$")
+
+	segments := []jsonPathSegment{}
+	for i := 0; i < len(path); {
+		switch path[i] {
+		case '.':
+			i++
+		case '[':
+			end := strings.Index(path[i:], "]")
+			if strings.HasPrefix(path[i:], "[?(") {
+				end = strings.Index(path[i:], ")]") + 1
+			}
+			if end <= 0 {
+				return nil, fmt.Errorf("unterminated bracket in path %s", path)
+			}
+			segment, err := parseJSONPathBracket(path[i+1 : i+end])
+			if err != nil {
+				return nil, fmt.Errorf("%w in path %s", err, path)
+			}
+			segments = append(segments, segment)
+			i += end + 1
+		default:
+			end := strings.IndexAny(path[i:], ".[")
+			if end < 0 {
+				end = len(path) - i
+			}
+			segments = append(segments, jsonPathSegment{field: path[i : i+end]})
+			i += end
+		}
+	}
+
+	return segments, nil
+}
+
+func parseJSONPathBracket(expression string) (jsonPathSegment, error) {
+	switch {
+	case expression == "*":
+		return jsonPathSegment{all: true}, nil
+	case strings.HasPrefix(expression, "?(") && strings.HasSuffix(expression, ")"):
+		condition := strings.TrimSuffix(strings.TrimPrefix(expression, "?("), ")")
+		field, value, ok := strings.Cut(condition, "==")
+		field = strings.TrimSpace(field)
+		if !ok || !strings.HasPrefix(field, "@.") {
+			return jsonPathSegment{}, fmt.Errorf("unsupported filter %s", expression)
+		}
+		return jsonPathSegment{
+			filter:      true,
+			filterPath:  strings.Split(strings.TrimPrefix(field, "@."), "."),
+			filterValue: strings.Trim(strings.TrimSpace(value), `"'`),
+		}, nil
+	case strings.HasPrefix(expression, "'") || strings.HasPrefix(expression, `"`):
+		return jsonPathSegment{field: strings.Trim(expression, `"'`)}, nil
+	default:
+		index, err := strconv.Atoi(expression)
+		if err != nil {
+			return jsonPathSegment{}, fmt.Errorf("unsupported expression [%s]", expression)
+		}
+		return jsonPathSegment{index: &index}, nil
+	}
+}
+
+// setJSONPath returns node with value set at every field matched by the segments. Missing
+// object fields are created, lists are only traversed.
+func setJSONPath(node interface{}, segments []jsonPathSegment, value interface{}) (interface{}, error) {
+	if len(segments) == 0 {
+		return value, nil
+	}
+	segment, rest := segments[0], segments[1:]
+
+	if segment.field != "" {
+		m, ok := node.(map[string]interface{})
+		if node == nil {
+			m, ok = map[string]interface{}{}, true
+		}
+		if !ok {
+			return nil, fmt.Errorf("field %s of a non-object", segment.field)
+		}
+		child, exists := m[segment.field]
+		if !exists && len(rest) > 0 && rest[0].field == "" {
+			// a missing list has nothing to match
+			return node, nil
+		}
+		child, err := setJSONPath(child, rest, value)
+		if err != nil {
+			return nil, err
+		}
+		m[segment.field] = child
+		return m, nil
+	}
+
+	list, ok := node.([]interface{})
+	if node == nil {
+		return node, nil
+	}
+	if !ok {
+		return nil, fmt.Errorf("list expression on a non-list")
+	}
+	for i, item := range list {
+		switch {
+		case segment.index != nil && *segment.index != i:
+			continue
+		case segment.filter && !jsonPathFilterMatches(item, segment):
+			continue
+		}
+		child, err := setJSONPath(item, rest, value)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = child
+	}
+	if segment.index != nil && (*segment.index < 0 || *segment.index >= len(list)) {
+		return nil, fmt.Errorf("index %d out of range", *segment.index)
+	}
+
+	return list, nil
+}
+
+func jsonPathFilterMatches(item interface{}, segment jsonPathSegment) bool {
+	for _, field := range segment.filterPath {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		item = m[field]
+	}
+	if item == nil {
+		return false
+	}
+
+	return fmt.Sprint(item) == segment.filterValue
+}
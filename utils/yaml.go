@@ -1,204 +1,108 @@
 package utils
 
 import (
-	"bytes"
-	"encoding/json"
-	"io"
-	"reflect"
-	"strings"
+	"log"
 
 	"github.com/LyridInc/cluster-api-go-sdk/option"
-	"gopkg.in/yaml.v2"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"
-	yamlserializer "k8s.io/apimachinery/pkg/runtime/serializer/yaml"
-	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
-
-	yamlmodel "github.com/LyridInc/cluster-api-go-sdk/yaml"
 )
 
+// UpdateYamlManifest applies the kind options of opt to a multi-document manifest like
+// UpdateUnstructuredObject, an option that can't be applied is logged and skipped. Use
+// PatchYamlManifest with ManifestOptionPatches to get the errors.
 func UpdateYamlManifest(yamlString string, opt option.ManifestOption) (string, error) {
-	var (
-		err        error
-		yamlResult string
-	)
-	decoder := yamlutil.NewYAMLOrJSONDecoder(bytes.NewReader([]byte(yamlString)), 100)
-	for {
-		var rawObj runtime.RawExtension
-		if err = decoder.Decode(&rawObj); err != nil {
-			break
-		}
+	patches := ManifestOptionPatches(opt)
+	return mapYamlManifest(yamlString, func(unstructuredObj *unstructured.Unstructured) error {
+		applyManifestOptionPatches(unstructuredObj, patches)
+		return nil
+	})
+}
 
-		obj, _, err := yamlserializer.NewDecodingSerializer(unstructured.UnstructuredJSONScheme).Decode(rawObj.Raw, nil, nil)
-		if err != nil {
-			return "", err
-		}
+// UpdateUnstructuredObject applies the kind options of opt to a copy of the object.
+//
+// Deprecated: an option that can't be applied is only logged and skipped, the other options
+// are still applied. Use PatchUnstructuredObject with ManifestOptionPatches to get the errors.
+func UpdateUnstructuredObject(unstructuredObj *unstructured.Unstructured, opt option.ManifestOption) *unstructured.Unstructured {
+	patched := unstructuredObj.DeepCopy()
+	applyManifestOptionPatches(patched, ManifestOptionPatches(opt))
+	return patched
+}
 
-		unstructuredMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
-		if err != nil {
-			return "", err
+// applyManifestOptionPatches applies every patch on its own so that a failing one doesn't
+// prevent the others.
+func applyManifestOptionPatches(unstructuredObj *unstructured.Unstructured, patches []option.ManifestPatch) {
+	for _, patch := range patches {
+		patched := unstructuredObj.DeepCopy()
+		if err := PatchUnstructuredObject(patched, []option.ManifestPatch{patch}); err != nil {
+			log.Printf("Skipping manifest option %s: %v", patch.Path, err)
+			continue
 		}
-
-		unstructuredObj := &unstructured.Unstructured{Object: unstructuredMap}
-		unstructuredObj = UpdateUnstructuredObject(unstructuredObj, opt)
-
-		x, _ := yaml.Marshal(unstructuredObj.Object)
-		yamlResult = yamlResult + "---\n" + string(x)
+		unstructuredObj.Object = patched.Object
 	}
-
-	if err != io.EOF {
-		return "", err
-	}
-
-	return yamlResult, nil
 }
 
-func UpdateUnstructuredObject(unstructuredObj *unstructured.Unstructured, opt option.ManifestOption) *unstructured.Unstructured {
-	apiVersion := unstructuredObj.GetAPIVersion()
-	kind := unstructuredObj.GetKind()
-
-	spec, ok := unstructuredObj.Object["spec"]
-	var (
-		specByte      []byte
-		objByte       []byte
-		specInterface interface{}
-	)
-	if ok {
-		specByte, _ = json.Marshal(spec)
+// legacyVolumeSecretNames are the secret volumes of the OpenStack cloud controller manager and
+// the Cinder CSI manifests that VolumeSecretName replaces.
+var legacyVolumeSecretNames = []string{"cloud-config-volume", "secret-cinderplugin"}
+
+// ManifestOptionPatches returns the patches equivalent to the kind options of opt.
+func ManifestOptionPatches(opt option.ManifestOption) []option.ManifestPatch {
+	patches := []option.ManifestPatch{}
+	set := func(target option.ManifestPatchTarget, path string, value interface{}) {
+		patches = append(patches, option.ManifestPatch{
+			Target: target,
+			Type:   option.ManifestPatchJSONPathSet,
+			Path:   path,
+			Value:  value,
+		})
 	}
-	unstructuredObjByte, _ := json.Marshal(unstructuredObj.Object)
-	kindMap := map[string]interface{}{}
 
-	if strings.HasPrefix(apiVersion, "storage.k8s.io") && kind == "StorageClass" {
-		storageClass := yamlmodel.StorageClass{}
-		json.Unmarshal(unstructuredObjByte, &storageClass)
-		if opt.StorageClassKindOption.Parameters != nil {
-			storageClass.Parameters = opt.StorageClassKindOption.Parameters
-		}
-		objByte, _ = json.Marshal(storageClass)
-	} else if kind == "Secret" {
-		secret := yamlmodel.Secret{}
-		json.Unmarshal(unstructuredObjByte, &secret)
-		if opt.SecretKindOption.Data != nil {
-			secret.Data = opt.SecretKindOption.Data
-		}
-		if opt.SecretKindOption.Metadata != nil {
-			secret.Metadata = opt.SecretKindOption.Metadata
-		}
-		objByte, _ = json.Marshal(secret)
-	} else if kind == "PersistentVolumeClaim" {
-		pvc := yamlmodel.PersistentVolumeClaim{}
-		json.Unmarshal(unstructuredObjByte, &pvc)
-		if opt.PersistentVolumeClaimKindOption.Metadata != nil {
-			pvc.Metadata = opt.PersistentVolumeClaimKindOption.Metadata
-		}
-		objByte, _ = json.Marshal(pvc)
-		if ok {
-			if opt.PersistentVolumeClaimKindOption.Storage != "" {
-				pvc.Spec.Resources.Requests.Storage = opt.PersistentVolumeClaimKindOption.Storage
-			}
-			if opt.PersistentVolumeClaimKindOption.StorageClassName != "" {
-				pvc.Spec.StorageClassName = opt.PersistentVolumeClaimKindOption.StorageClassName
-			}
-			if opt.PersistentVolumeClaimKindOption.VolumeMode != "" {
-				pvc.Spec.VolumeMode = opt.PersistentVolumeClaimKindOption.VolumeMode
-			}
-			specInterface = pvc.Spec
-		}
+	if opt.StorageClassKindOption.Parameters != nil {
+		set(option.ManifestPatchTarget{Group: "storage.k8s.io", Kind: "StorageClass"}, ".parameters", opt.StorageClassKindOption.Parameters)
 	}
 
-	if len(objByte) > 0 {
-		json.Unmarshal(objByte, &kindMap)
-		unstructuredObj.Object = kindMap
+	secretTarget := option.ManifestPatchTarget{Kind: "Secret"}
+	if opt.SecretKindOption.Data != nil {
+		set(secretTarget, ".data", opt.SecretKindOption.Data)
+	}
+	if opt.SecretKindOption.Metadata != nil {
+		set(secretTarget, ".metadata", opt.SecretKindOption.Metadata)
 	}
 
-	if ok {
-		if strings.HasPrefix(apiVersion, "infrastructure.cluster.x-k8s.io") && kind == "OpenStackCluster" {
-			infrastructureSpec := yamlmodel.InfrastructureSpec{}
-			json.Unmarshal(specByte, &infrastructureSpec)
-			if len(opt.InfrastructureKindSpecOption.ManagedSubnets) > 0 {
-				infrastructureSpec.ManagedSubnets = opt.InfrastructureKindSpecOption.ManagedSubnets
-			}
-			// infrastructureSpec.AllowAllInClusterTraffic = opt.InfrastructureKindSpecOption.AllowAllInClusterTraffic
-			specInterface = infrastructureSpec
-		} else if strings.HasPrefix(apiVersion, "cluster.x-k8s.io") && kind == "Cluster" {
-			clusterSpec := yamlmodel.ClusterSpec{}
-			json.Unmarshal(specByte, &clusterSpec)
-			if opt.ClusterKindSpecOption.CidrBlocks != nil {
-				clusterSpec.ClusterNetwork.Pods.CidrBlocks = opt.ClusterKindSpecOption.CidrBlocks
-			}
-			specInterface = clusterSpec
-		} else if strings.HasPrefix(apiVersion, "apps") && kind == "DaemonSet" {
-			daemonSetSpec := yamlmodel.DaemonSetSpec{}
-			json.Unmarshal(specByte, &daemonSetSpec)
-			if opt.DaemonSetKindOption.VolumeSecretName != "" {
-				for i, v := range daemonSetSpec.Template.Spec.Volumes {
-					vv := v.(map[string]interface{})
-					if vv["name"] == "cloud-config-volume" || vv["name"] == "secret-cinderplugin" {
-						vvs := vv["secret"].(map[string]interface{})
-						vvs["secretName"] = opt.DaemonSetKindOption.VolumeSecretName
-						vv["secret"] = vvs
-						daemonSetSpec.Template.Spec.Volumes[i] = vv
-					}
-				}
-			}
-			specInterface = daemonSetSpec
-		} else if strings.HasPrefix(apiVersion, "apps") && kind == "Deployment" {
-			deploymentSpec := yamlmodel.DeploymentSpec{}
-			json.Unmarshal(specByte, &deploymentSpec)
-			if opt.DeploymentKindOption.VolumeSecretName != "" {
-				for i, v := range deploymentSpec.Template.Spec.Volumes {
-					vv := v.(map[string]interface{})
-					if vv["name"] == "cloud-config-volume" || vv["name"] == "secret-cinderplugin" {
-						vvs := vv["secret"].(map[string]interface{})
-						vvs["secretName"] = opt.DeploymentKindOption.VolumeSecretName
-						vv["secret"] = vvs
-						deploymentSpec.Template.Spec.Volumes[i] = vv
-					}
-				}
-			}
-			specInterface = deploymentSpec
-		}
-
-		if !reflect.ValueOf(&specInterface).Elem().IsNil() {
-			m := map[string]interface{}{}
-			specByte, _ = json.Marshal(specInterface)
-			json.Unmarshal(specByte, &m)
-			removeNulls(m)
-			unstructuredObj.Object["spec"] = m
-		}
+	pvcTarget := option.ManifestPatchTarget{Kind: "PersistentVolumeClaim"}
+	pvcOption := opt.PersistentVolumeClaimKindOption
+	if pvcOption.Metadata != nil {
+		set(pvcTarget, ".metadata", pvcOption.Metadata)
+	}
+	if pvcOption.Storage != "" {
+		set(pvcTarget, ".spec.resources.requests.storage", pvcOption.Storage)
+	}
+	if pvcOption.StorageClassName != "" {
+		set(pvcTarget, ".spec.storageClassName", pvcOption.StorageClassName)
+	}
+	if pvcOption.VolumeMode != "" {
+		set(pvcTarget, ".spec.volumeMode", pvcOption.VolumeMode)
 	}
 
-	return unstructuredObj
-}
+	if len(opt.InfrastructureKindSpecOption.ManagedSubnets) > 0 {
+		set(option.ManifestPatchTarget{Group: "infrastructure.cluster.x-k8s.io", Kind: "OpenStackCluster"}, ".spec.managedSubnets", opt.InfrastructureKindSpecOption.ManagedSubnets)
+	}
+	if opt.ClusterKindSpecOption.CidrBlocks != nil {
+		set(option.ManifestPatchTarget{Group: "cluster.x-k8s.io", Kind: "Cluster"}, ".spec.clusterNetwork.pods.cidrBlocks", opt.ClusterKindSpecOption.CidrBlocks)
+	}
 
-func removeNulls(m map[string]interface{}) {
-	val := reflect.ValueOf(m)
-	for _, e := range val.MapKeys() {
-		v := val.MapIndex(e)
-		if v.IsNil() {
-			delete(m, e.String())
+	volumeSecretNames := []struct{ kind, secretName string }{
+		{"DaemonSet", opt.DaemonSetKindOption.VolumeSecretName},
+		{"Deployment", opt.DeploymentKindOption.VolumeSecretName},
+	}
+	for _, v := range volumeSecretNames {
+		if v.secretName == "" {
 			continue
 		}
-		switch t := v.Interface().(type) {
-		// If key is a JSON object (Go Map), use recursion to go deeper
-		case map[string]interface{}:
-			removeNulls(t)
-
-		case string:
-			if string(t) == "" {
-				delete(m, e.String())
-				continue
-			}
-
-		case []interface{}:
-			for _, vv := range t {
-				vvr := reflect.ValueOf(vv)
-				switch tvv := vvr.Interface().(type) {
-				case map[string]interface{}:
-					removeNulls(tvv)
-				}
-			}
+		for _, volume := range legacyVolumeSecretNames {
+			set(option.ManifestPatchTarget{Group: "apps", Kind: v.kind}, `.spec.template.spec.volumes[?(@.name=="`+volume+`")].secret.secretName`, v.secretName)
 		}
 	}
+
+	return patches
 }